@@ -3,57 +3,219 @@ package auth
 import (
 	"context"
 	"errors"
+	"fmt"
 	"io"
+	"net/http"
 	"os"
+	"path"
 	"path/filepath"
 	"runtime"
+	"strings"
 	"time"
 
 	"github.com/google/go-github/v67/github"
 	"go.uber.org/zap"
 	"golang.org/x/oauth2"
+
+	"github.com/serenibyss/nhprtracker/internal"
 )
 
 type GithubClient struct {
 	*github.Client
 
-	Ctx    context.Context
-	Org    string
+	Ctx   context.Context
+	Org   string
+	Repos []string
+
+	// Date is the start of the window merged PRs are gathered from.
+	Date time.Time
+
+	// EndDate is the last instant of the window merged PRs are gathered from,
+	// or zero to gather PRs up to now.
+	EndDate time.Time
+
+	// SinceTag and UntilTag bound the window of each repository having them
+	// by the commit dates of these tags instead of Date and EndDate.
+	SinceTag string
+	UntilTag string
+
+	// windows holds the windows of repositories bound by tags, keyed by
+	// repository name.
+	windows map[string]Window
+
+	// Branch is the release branch the client targets. It is empty with
+	// several release branches or a pattern, use WithBranch to target each
+	// resolved branch.
 	Branch string
-	Repos  []string
-	Date   time.Time
+
+	// Branches holds the release branches to check, which may be glob
+	// patterns like "release/2.*".
+	Branches []string
+
+	// Concurrency is the maximum number of repositories scanned at once.
+	Concurrency int
+
+	// API is the GitHub API used to gather PRs and release branch data,
+	// either APIREST or APIGraphQL.
+	API string
+
+	// Exclusions holds the repositories and PRs left out of reports.
+	Exclusions *internal.Exclusions
 }
 
-func GetClient(org string, branch string, repos []string, timestamp time.Time, token string) (*GithubClient, error) {
-	token = getToken(token)
+// GitHub APIs that can be used to gather data.
+const (
+	APIREST    = "rest"
+	APIGraphQL = "graphql"
+)
+
+// ClientOptions configures the client created by GetClient.
+type ClientOptions struct {
+	Org         string
+	Branches    []string
+	Repos       []string
+	Date        time.Time
+	EndDate     time.Time
+	SinceTag    string
+	UntilTag    string
+	Token       string
+	Concurrency int
+	NoCache     bool
+	API         string
+	Exclusions  *internal.Exclusions
+}
+
+// GetClient creates an authenticated GitHub client. Requests made by the
+// client are cancelled when ctx is.
+func GetClient(ctx context.Context, opts *ClientOptions) (*GithubClient, error) {
+	api := opts.API
+	if api == "" {
+		api = APIREST
+	}
+	if api != APIREST && api != APIGraphQL {
+		return nil, fmt.Errorf("unsupported api option %s, allowed: '%s', '%s'", api, APIREST, APIGraphQL)
+	}
+
+	if !opts.EndDate.IsZero() && !opts.EndDate.After(opts.Date) {
+		return nil, fmt.Errorf("end date %s is not after start date %s", opts.EndDate.Format(time.RFC3339), opts.Date.Format(time.RFC3339))
+	}
+
+	if len(opts.Branches) == 0 {
+		return nil, errors.New("no release branch specified")
+	}
+	for _, branch := range opts.Branches {
+		if _, err := path.Match(branch, ""); err != nil {
+			return nil, fmt.Errorf("release branch pattern %q malformed: %w", branch, err)
+		}
+	}
+
+	token := getToken(opts.Token)
 	if token == "" {
 		return nil, errors.New("could not find GITHUB_TOKEN environment variable")
 	}
 
-	ctx := context.Background()
 	ts := oauth2.StaticTokenSource(&oauth2.Token{
 		AccessToken: token,
 	})
-	tc := oauth2.NewClient(ctx, ts)
-	client := github.NewClient(tc)
+	var transport http.RoundTripper = &rateLimitTransport{
+		base: &oauth2.Transport{
+			Source: ts,
+			Base:   http.DefaultTransport,
+		},
+	}
+	if !opts.NoCache {
+		cache, err := newCacheTransport(transport, token)
+		if err != nil {
+			zap.S().Named("auth").Warnf("running without response cache: %v", err)
+		} else {
+			transport = cache
+		}
+	}
+	client := github.NewClient(&http.Client{Transport: transport})
+
+	zap.S().Named("auth").Infof("Organization: %s", opts.Org)
+	zap.S().Named("auth").Infof("Release Branches: %v", opts.Branches)
+	if len(opts.Repos) > 0 {
+		zap.S().Named("auth").Infof("Specific Repos: %v", opts.Repos)
+	}
+	zap.S().Named("auth").Infof("PRs After Date: %s", opts.Date.Format(time.RFC3339))
+	if !opts.EndDate.IsZero() {
+		zap.S().Named("auth").Infof("PRs Before Date: %s", opts.EndDate.Format(time.RFC3339))
+	}
+	if opts.SinceTag != "" {
+		zap.S().Named("auth").Infof("PRs After Tag: %s", opts.SinceTag)
+	}
+	if opts.UntilTag != "" {
+		zap.S().Named("auth").Infof("PRs Before Tag: %s", opts.UntilTag)
+	}
 
-	zap.S().Named("auth").Infof("Organization: %s", org)
-	zap.S().Named("auth").Infof("Release Branch Name: %s", branch)
-	if len(repos) > 0 {
-		zap.S().Named("auth").Infof("Specific Repos: %v", repos)
+	// Patterns are only resolved against repositories, so a single target
+	// branch is only known up front for one branch name
+	var branch string
+	if len(opts.Branches) == 1 && !strings.ContainsAny(opts.Branches[0], "*?[") {
+		branch = opts.Branches[0]
+	}
+
+	concurrency := opts.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
 	}
-	zap.S().Named("auth").Infof("PRs After Date: %s", timestamp.Format(time.RFC3339))
 
 	return &GithubClient{
-		Client: client,
-		Ctx:    ctx,
-		Org:    org,
-		Branch: branch,
-		Repos:  repos,
-		Date:   timestamp,
+		Client:      client,
+		Ctx:         ctx,
+		Org:         opts.Org,
+		Branch:      branch,
+		Branches:    opts.Branches,
+		Repos:       opts.Repos,
+		Date:        opts.Date,
+		EndDate:     opts.EndDate,
+		SinceTag:    opts.SinceTag,
+		UntilTag:    opts.UntilTag,
+		windows:     map[string]Window{},
+		Concurrency: concurrency,
+		API:         api,
+		Exclusions:  opts.Exclusions,
 	}, nil
 }
 
+// WithBranch returns a copy of the client targeting a single release branch.
+func (c *GithubClient) WithBranch(branch string) *GithubClient {
+	clone := *c
+	clone.Branch = branch
+	clone.Branches = []string{branch}
+	return &clone
+}
+
+// Window is a range of time merged PRs are gathered from, including both
+// Start and End. A zero End leaves the window open up to now.
+type Window struct {
+	Start time.Time
+	End   time.Time
+}
+
+// Contains checks if the time falls within the window.
+func (w Window) Contains(t time.Time) bool {
+	return !t.Before(w.Start) && (w.End.IsZero() || !t.After(w.End))
+}
+
+// Window returns the window merged PRs of the repository are gathered from.
+func (c *GithubClient) Window(repoName string) Window {
+	if w, ok := c.windows[repoName]; ok {
+		return w
+	}
+	return Window{Start: c.Date, End: c.EndDate}
+}
+
+// SetWindow overrides the window merged PRs of the repository are gathered
+// from. It is not safe to call concurrently with other methods of the client.
+func (c *GithubClient) SetWindow(repoName string, w Window) {
+	if c.windows == nil {
+		c.windows = map[string]Window{}
+	}
+	c.windows[repoName] = w
+}
+
 func getToken(token string) string {
 	if token != "" {
 		return token
@@ -0,0 +1,203 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/serenibyss/nhprtracker/internal"
+)
+
+// cacheTransport stores GitHub responses on disk and revalidates them with
+// conditional requests on later runs. GitHub does not count a 304 Not Modified
+// response against the rate limit, so unchanged pages are almost free.
+type cacheTransport struct {
+	base http.RoundTripper
+	dir  string
+
+	// keyPrefix separates the responses seen by different tokens, as they
+	// may have access to different data.
+	keyPrefix string
+}
+
+// cacheEntry is a response stored on disk.
+type cacheEntry struct {
+	URL        string      `json:"url"`
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header"`
+	Body       []byte      `json:"body"`
+}
+
+// CacheDir returns the directory GitHub responses are cached in.
+func CacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("could not find user cache directory: %w", err)
+	}
+	return filepath.Join(dir, internal.AppName, "http"), nil
+}
+
+// ClearCache removes all cached GitHub responses, returning the directory
+// that was cleared.
+func ClearCache() (string, error) {
+	dir, err := CacheDir()
+	if err != nil {
+		return "", err
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return dir, fmt.Errorf("failed to clear cache: %w", err)
+	}
+	return dir, nil
+}
+
+func newCacheTransport(base http.RoundTripper, token string) (*cacheTransport, error) {
+	dir, err := CacheDir()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+
+	sum := sha256.Sum256([]byte(token))
+	return &cacheTransport{
+		base:      base,
+		dir:       dir,
+		keyPrefix: hex.EncodeToString(sum[:8]),
+	}, nil
+}
+
+func (t *cacheTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet {
+		return t.base.RoundTrip(req)
+	}
+
+	path := t.path(req)
+	entry := t.load(path)
+	if entry != nil {
+		req = req.Clone(req.Context())
+		if etag := entry.Header.Get("ETag"); etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		if modified := entry.Header.Get("Last-Modified"); modified != "" {
+			req.Header.Set("If-Modified-Since", modified)
+		}
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && entry != nil:
+		zap.S().Named("cache").Debugf("cache hit for %s", req.URL.Path)
+		_, _ = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		return entry.response(req, resp.Header), nil
+	case resp.StatusCode == http.StatusOK && (resp.Header.Get("ETag") != "" || resp.Header.Get("Last-Modified") != ""):
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+
+		t.store(path, &cacheEntry{
+			URL:        req.URL.String(),
+			StatusCode: resp.StatusCode,
+			Header:     resp.Header,
+			Body:       body,
+		})
+		return resp, nil
+	default:
+		return resp, nil
+	}
+}
+
+// path returns the file a response to the request is cached in.
+func (t *cacheTransport) path(req *http.Request) string {
+	sum := sha256.Sum256([]byte(strings.Join([]string{
+		t.keyPrefix,
+		req.URL.String(),
+		req.Header.Get("Accept"),
+	}, "\n")))
+	return filepath.Join(t.dir, hex.EncodeToString(sum[:])+".json")
+}
+
+func (t *cacheTransport) load(path string) *cacheEntry {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			zap.S().Named("cache").Debugf("failed to read cache entry %s: %v", path, err)
+		}
+		return nil
+	}
+
+	var entry cacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		zap.S().Named("cache").Debugf("ignoring corrupt cache entry %s: %v", path, err)
+		return nil
+	}
+	return &entry
+}
+
+func (t *cacheTransport) store(path string, entry *cacheEntry) {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		zap.S().Named("cache").Debugf("failed to encode cache entry for %s: %v", entry.URL, err)
+		return
+	}
+
+	// write to a temporary file first so concurrent readers never see a partial entry
+	tmp, err := os.CreateTemp(t.dir, "entry-*.tmp")
+	if err != nil {
+		zap.S().Named("cache").Debugf("failed to create cache entry for %s: %v", entry.URL, err)
+		return
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		zap.S().Named("cache").Debugf("failed to write cache entry for %s: %v", entry.URL, err)
+		_ = os.Remove(tmp.Name())
+	}
+}
+
+// response rebuilds the cached response. Rate limit headers are taken from
+// the revalidation response so quota reporting stays accurate.
+func (e *cacheEntry) response(req *http.Request, fresh http.Header) *http.Response {
+	header := e.Header.Clone()
+	for key, values := range fresh {
+		if strings.HasPrefix(key, "X-Ratelimit-") {
+			header[key] = values
+		}
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", e.StatusCode, http.StatusText(e.StatusCode)),
+		StatusCode:    e.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(e.Body)),
+		ContentLength: int64(len(e.Body)),
+		Request:       req,
+	}
+}
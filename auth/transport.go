@@ -0,0 +1,146 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// maxRetries is the number of times a request is retried before its
+	// failed response is handed back to the caller.
+	maxRetries = 5
+
+	// secondaryRateLimitWait is how long to wait after hitting a secondary
+	// rate limit that did not say how long to wait, as recommended by GitHub.
+	secondaryRateLimitWait = time.Minute
+)
+
+// rateLimitTransport waits out GitHub's primary and secondary rate limits
+// instead of failing, and retries idempotent requests that failed with a
+// server error.
+type rateLimitTransport struct {
+	base http.RoundTripper
+}
+
+func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	attemptReq := req
+	for attempt := 0; ; attempt++ {
+		resp, err := t.base.RoundTrip(attemptReq)
+		if err != nil {
+			return nil, err
+		}
+		logQuota(req, resp)
+
+		wait, retry := retryDelay(req, resp, attempt)
+		if !retry {
+			// last request before the primary limit is exhausted, wait for the reset
+			// here so the next request is not rejected
+			if resp.StatusCode < 300 && resp.Header.Get("X-RateLimit-Remaining") == "0" {
+				if reset := untilReset(resp.Header); reset > 0 {
+					zap.S().Named("auth").Warnf("GitHub rate limit exhausted, waiting %s for it to reset", reset.Round(time.Second))
+					if err := sleepContext(req.Context(), reset); err != nil {
+						resp.Body.Close()
+						return nil, err
+					}
+				}
+			}
+			return resp, nil
+		}
+		if attempt >= maxRetries || !rewindable(req) {
+			return resp, nil
+		}
+
+		_, _ = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+
+		zap.S().Named("auth").Warnf("%s %s failed with %s, retrying in %s", req.Method, req.URL.Path, resp.Status, wait.Round(time.Second))
+		if err := sleepContext(req.Context(), wait); err != nil {
+			return nil, err
+		}
+
+		attemptReq = req.Clone(req.Context())
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			attemptReq.Body = body
+		}
+	}
+}
+
+// retryDelay decides whether a response should be retried, and how long to
+// wait before doing so.
+func retryDelay(req *http.Request, resp *http.Response, attempt int) (time.Duration, bool) {
+	switch {
+	case resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusTooManyRequests:
+		if wait, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+			return time.Duration(wait) * time.Second, true
+		}
+		if resp.Header.Get("X-RateLimit-Remaining") == "0" {
+			return untilReset(resp.Header), true
+		}
+		if isSecondaryRateLimit(resp) {
+			return secondaryRateLimitWait << attempt, true
+		}
+		return 0, false
+	case resp.StatusCode >= 500 && (req.Method == http.MethodGet || req.Method == http.MethodHead):
+		return time.Second << attempt, true
+	default:
+		return 0, false
+	}
+}
+
+// isSecondaryRateLimit checks the error message of a rejected response for
+// GitHub's secondary rate limit, leaving the body readable for the caller.
+func isSecondaryRateLimit(resp *http.Response) bool {
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return false
+	}
+	return strings.Contains(strings.ToLower(string(body)), "secondary rate limit")
+}
+
+// untilReset returns the time left until the primary rate limit resets.
+func untilReset(header http.Header) time.Duration {
+	reset, err := strconv.ParseInt(header.Get("X-RateLimit-Reset"), 10, 64)
+	if err != nil {
+		return 0
+	}
+	// a little leeway for clock differences with GitHub
+	return time.Until(time.Unix(reset, 0)) + time.Second
+}
+
+// rewindable reports whether the request body can be sent again.
+func rewindable(req *http.Request) bool {
+	return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+}
+
+func logQuota(req *http.Request, resp *http.Response) {
+	remaining := resp.Header.Get("X-RateLimit-Remaining")
+	if remaining == "" {
+		return
+	}
+	zap.S().Named("auth").Debugf("%s %s: %s/%s %s requests remaining",
+		req.Method, req.URL.Path, remaining, resp.Header.Get("X-RateLimit-Limit"), resp.Header.Get("X-RateLimit-Resource"))
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
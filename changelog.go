@@ -0,0 +1,198 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v67/github"
+)
+
+// otherSection collects PRs that carry none of the mapped labels.
+const otherSection = "Other"
+
+// ChangelogSection is a heading in the changelog and the labels that place a
+// PR under it.
+type ChangelogSection struct {
+	Title  string
+	Labels []string
+}
+
+var defaultChangelogSections = []ChangelogSection{
+	{Title: "Features", Labels: []string{"enhancement", "feature", "new feature"}},
+	{Title: "Fixes", Labels: []string{"bug", "bugfix", "fix"}},
+	{Title: "Balance", Labels: []string{"balance"}},
+	{Title: "Translation", Labels: []string{"translation", "localization"}},
+	{Title: "Internal", Labels: []string{"internal", "refactor", "dependencies", "ci"}},
+}
+
+// ParseChangelogSections applies 'label=Section' mappings on top of the default
+// sections. A label mapped to a new section name adds that section after the
+// defaults, in the order it was first seen.
+func ParseChangelogSections(mappings []string) ([]ChangelogSection, error) {
+	sections := slices.Clone(defaultChangelogSections)
+	for i := range sections {
+		sections[i].Labels = slices.Clone(sections[i].Labels)
+	}
+
+	for _, mapping := range mappings {
+		label, title, ok := strings.Cut(mapping, "=")
+		label, title = strings.TrimSpace(label), strings.TrimSpace(title)
+		if !ok || label == "" || title == "" {
+			return nil, fmt.Errorf("label section mapping %q malformed, must be in LABEL=SECTION format", mapping)
+		}
+
+		// a label only ever belongs to one section
+		for i := range sections {
+			sections[i].Labels = slices.DeleteFunc(sections[i].Labels, func(l string) bool {
+				return strings.EqualFold(l, label)
+			})
+		}
+
+		idx := slices.IndexFunc(sections, func(s ChangelogSection) bool {
+			return strings.EqualFold(s.Title, title)
+		})
+		if idx == -1 {
+			sections = append(sections, ChangelogSection{Title: title})
+			idx = len(sections) - 1
+		}
+		sections[idx].Labels = append(sections[idx].Labels, label)
+	}
+	return sections, nil
+}
+
+// sectionFor returns the title of the first section with a label on the PR.
+func sectionFor(sections []ChangelogSection, pr *github.PullRequest) string {
+	for _, section := range sections {
+		for _, label := range pr.Labels {
+			if slices.ContainsFunc(section.Labels, func(l string) bool {
+				return strings.EqualFold(l, label.GetName())
+			}) {
+				return section.Title
+			}
+		}
+	}
+	return otherSection
+}
+
+// WriteChangelog writes a Markdown changelog of the merged PRs grouped by
+// repository, then by section, followed by a list of contributors.
+func WriteChangelog(w io.Writer, report *Report, sections []ChangelogSection) error {
+	var b strings.Builder
+	contributors := map[string]bool{}
+
+	fmt.Fprintln(&b, "# Changelog")
+	fmt.Fprintln(&b)
+	fmt.Fprintf(&b, "Pull requests merged into %s repositories %s.\n", report.Org, changelogWindow(report))
+	if excluded := changelogExcluded(report); excluded != "" {
+		fmt.Fprintln(&b)
+		fmt.Fprintln(&b, excluded)
+	}
+
+	titles := []string{}
+	for _, section := range sections {
+		titles = append(titles, section.Title)
+	}
+	if !slices.Contains(titles, otherSection) {
+		titles = append(titles, otherSection)
+	}
+
+	for _, repo := range report.Repos() {
+		prs := report.PRs[repo]
+		if len(prs) == 0 {
+			continue
+		}
+
+		grouped := map[string][]*github.PullRequest{}
+		for _, pr := range prs {
+			section := sectionFor(sections, pr)
+			grouped[section] = append(grouped[section], pr)
+			if login := pr.GetUser().GetLogin(); login != "" {
+				contributors[login] = true
+			}
+		}
+
+		fmt.Fprintln(&b)
+		fmt.Fprintf(&b, "## %s\n", repo)
+		for _, title := range titles {
+			if len(grouped[title]) == 0 {
+				continue
+			}
+			fmt.Fprintln(&b)
+			fmt.Fprintf(&b, "### %s\n", title)
+			for _, pr := range grouped[title] {
+				fmt.Fprintf(&b, "- %s ([#%d](%s))", pr.GetTitle(), pr.GetNumber(), pr.GetHTMLURL())
+				if login := pr.GetUser().GetLogin(); login != "" {
+					fmt.Fprintf(&b, " by @%s", login)
+				}
+				if note := report.RevertNote(pr); note != "" {
+					fmt.Fprintf(&b, " *(%s)*", note)
+				}
+				fmt.Fprintln(&b)
+			}
+		}
+	}
+
+	if len(contributors) != 0 {
+		var names []string
+		for name := range contributors {
+			names = append(names, "@"+name)
+		}
+		slices.SortFunc(names, func(a, b string) int {
+			return strings.Compare(strings.ToLower(a), strings.ToLower(b))
+		})
+
+		fmt.Fprintln(&b)
+		fmt.Fprintln(&b, "## Contributors")
+		fmt.Fprintln(&b)
+		fmt.Fprintf(&b, "Thanks to %s for their contributions!\n", strings.Join(names, ", "))
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// changelogExcluded describes how many PRs the exclusion rules left out of
+// the changelog, like "Left out 3 PRs by author dependabot[bot], 1 PR by label
+// duplicate.", or returns an empty string if none were.
+func changelogExcluded(report *Report) string {
+	var parts []string
+	for _, excluded := range report.Excluded {
+		noun := "PRs"
+		if excluded.Count == 1 {
+			noun = "PR"
+		}
+		parts = append(parts, fmt.Sprintf("%d %s by %s", excluded.Count, noun, excluded.Rule))
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return "Left out " + strings.Join(parts, ", ") + "."
+}
+
+// changelogWindow describes the window the PRs of the changelog were merged
+// in, like "since 2024-12-08 until 2025-01-15".
+func changelogWindow(report *Report) string {
+	since := report.Date.Format(time.DateOnly)
+	if report.SinceTag != "" {
+		since = fmt.Sprintf("%s (or %s)", report.SinceTag, since)
+	}
+	window := "since " + since
+
+	var until string
+	if !report.EndDate.IsZero() {
+		until = report.EndDate.Format(time.DateOnly)
+	}
+	if report.UntilTag != "" {
+		if until == "" {
+			until = "now"
+		}
+		until = fmt.Sprintf("%s (or %s)", report.UntilTag, until)
+	}
+	if until != "" {
+		window += " until " + until
+	}
+	return window
+}
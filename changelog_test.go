@@ -0,0 +1,38 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/serenibyss/nhprtracker/internal"
+)
+
+func TestWriteChangelogExcluded(t *testing.T) {
+	report := &Report{
+		Org:  "org",
+		Date: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		Excluded: []internal.ExclusionCount{
+			{Rule: "author dependabot[bot]", Count: 3},
+			{Rule: "label duplicate", Count: 1},
+		},
+	}
+
+	var b strings.Builder
+	if err := WriteChangelog(&b, report, defaultChangelogSections); err != nil {
+		t.Fatal(err)
+	}
+	want := "Left out 3 PRs by author dependabot[bot], 1 PR by label duplicate."
+	if !strings.Contains(b.String(), want) {
+		t.Errorf("changelog does not contain %q:\n%s", want, b.String())
+	}
+
+	report.Excluded = nil
+	b.Reset()
+	if err := WriteChangelog(&b, report, defaultChangelogSections); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(b.String(), "Left out") {
+		t.Errorf("changelog without exclusions mentions them:\n%s", b.String())
+	}
+}
@@ -1,11 +1,16 @@
 package main
 
 import (
+	"bufio"
+	"context"
 	"errors"
+	"fmt"
 	"os"
+	"os/signal"
 	"strings"
 	"time"
 
+	gogithub "github.com/google/go-github/v67/github"
 	"github.com/urfave/cli/v2"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
@@ -26,6 +31,17 @@ func main() {
 		Description: cliDescription,
 		Suggest:     true,
 		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:        "config",
+				Usage:       "read flags not set on the command line from this YAML config file",
+				DefaultText: "'" + internal.AppName + "/config.yaml' in the user config directory",
+				TakesFile:   true,
+			},
+			&cli.StringFlag{
+				Name:        "profile",
+				Usage:       "select a named profile of the config file",
+				DefaultText: "the config file's 'default_profile', or 'default'",
+			},
 			&cli.StringFlag{
 				Name:        "token",
 				Aliases:     []string{"t"},
@@ -36,7 +52,21 @@ func main() {
 				Name:    "start-date",
 				Aliases: []string{"d"},
 				Value:   internal.DefaultStartDate,
-				Usage:   "set a start date to check for PRs and commits, format YYYY-MM-DD",
+				Usage:   "set a start date to check for PRs and commits, format YYYY-MM-DD or a duration before now like '14d'",
+			},
+			&cli.StringFlag{
+				Name:        "end-date",
+				Aliases:     []string{"e"},
+				Usage:       "set an end date to check for PRs and commits, format YYYY-MM-DD or a duration before now like '2w'. A YYYY-MM-DD end date is inclusive, covering PRs merged up to the end of that day (UTC)",
+				DefaultText: "now",
+			},
+			&cli.StringFlag{
+				Name:  "since-tag",
+				Usage: "start checking each repo from the commit date of this tag, falling back to 'start-date' for repos without it",
+			},
+			&cli.StringFlag{
+				Name:  "until-tag",
+				Usage: "stop checking each repo at the commit date of this tag, falling back to 'end-date' for repos without it",
 			},
 			&cli.StringFlag{
 				Name:    "organization",
@@ -44,22 +74,75 @@ func main() {
 				Value:   internal.DefaultOrganization,
 				Usage:   "set an organization to check for PRs and commits",
 			},
-			&cli.StringFlag{
+			&cli.StringSliceFlag{
 				Name:    "release-branch",
 				Aliases: []string{"branch", "b"},
-				Value:   internal.DefaultReleaseBranch,
-				Usage:   "target branch to check against when scanning master/main branch",
+				Value:   cli.NewStringSlice(internal.DefaultReleaseBranch),
+				Usage:   "target branch to check against when scanning master/main branch. May be repeated or a glob like 'release/2.*' to check several branches at once",
 			},
 			&cli.StringSliceFlag{
 				Name:    "repos",
 				Aliases: []string{"r"},
 				Usage:   "select specific repos to target for PR checking",
 			},
+			&cli.StringSliceFlag{
+				Name:  "exclude-repo",
+				Value: cli.NewStringSlice(internal.ExcludedRepositories...),
+				Usage: "repos left out of every command, replacing the defaults. Globs, or regular expressions prefixed with 're:'",
+			},
+			&cli.StringSliceFlag{
+				Name:  "exclude-title",
+				Value: cli.NewStringSlice(internal.ExcludedPRTitles...),
+				Usage: "titles of PRs left out of reports, replacing the defaults. Globs, or regular expressions prefixed with 're:'",
+			},
+			&cli.StringSliceFlag{
+				Name:  "exclude-author",
+				Value: cli.NewStringSlice(internal.ExcludedPRAuthors...),
+				Usage: "authors of PRs left out of reports, replacing the defaults. Globs, or regular expressions prefixed with 're:'",
+			},
+			&cli.StringSliceFlag{
+				Name:  "exclude-pr-label",
+				Usage: "labels of PRs left out of every report as they are gathered, counted in the excluded totals. Unlike 'exclude-label' of unmerged-prs and backport, this also applies to all-prs and changelog",
+			},
+			&cli.IntFlag{
+				Name:    "concurrency",
+				Aliases: []string{"j"},
+				Value:   internal.DefaultConcurrency,
+				Usage:   "number of repositories to scan at the same time",
+			},
+			&cli.StringFlag{
+				Name:  "api",
+				Value: auth.APIREST,
+				Usage: "GitHub API used to gather PRs and release branches. Either 'rest', or 'graphql' for fewer, batched requests",
+			},
+			&cli.BoolFlag{
+				Name:  "no-cache",
+				Usage: "do not read or store GitHub responses in the on-disk cache",
+			},
 			&cli.StringFlag{
 				Name:    "formatting",
 				Aliases: []string{"f"},
 				Value:   internal.DefaultFormatting,
-				Usage:   "formatting for output text. Either 'terminal' for command line formatting, or 'discord' for copy-pasting",
+				Usage:   "formatting for output text. Either 'terminal' for command line formatting, 'discord' for copy-pasting, 'json' for machine-readable output, or 'template' for a custom layout",
+			},
+			&cli.StringFlag{
+				Name:      "template",
+				Usage:     "render output through a Go text/template file, implies '--formatting template'",
+				TakesFile: true,
+			},
+			&cli.StringFlag{
+				Name:      "discord-chunk-dir",
+				Usage:     "write each discord message to a separate file in this directory instead of printing them",
+				TakesFile: true,
+			},
+			&cli.StringFlag{
+				Name:  "discord-webhook",
+				Usage: "post output directly to this discord webhook URL, implies '--formatting discord'",
+			},
+			&cli.StringFlag{
+				Name:  "reverts",
+				Value: github.RevertsFlag,
+				Usage: "how to report PRs that were reverted after merging. Either 'flag' to mark them, 'drop' to leave them and their reverts out, or 'ignore' to skip detecting them",
 			},
 			&cli.BoolFlag{
 				Name:   "debug",
@@ -70,6 +153,19 @@ func main() {
 			if cCtx.Bool("debug") {
 				debugLogs = true
 			}
+			profile, err := loadConfig(cCtx)
+			if err != nil {
+				return err
+			}
+			if profile != nil {
+				activeProfile = profile
+				if err := applyConfig(cCtx, profile); err != nil {
+					return err
+				}
+			}
+			if err := github.CheckRevertsMode(cCtx.String("reverts")); err != nil {
+				return err
+			}
 			zap.S().Debug(internal.AppVersion())
 			return nil
 		},
@@ -78,24 +174,12 @@ func main() {
 				Name:  "all-prs",
 				Usage: "Gather all PRs merged into the master/main branch after the specified date",
 				Action: func(cCtx *cli.Context) error {
-					org := cCtx.String("organization")
-					branch := cCtx.String("release-branch")
-					repos := cCtx.StringSlice("repos")
-					token := cCtx.String("token")
-					if token != "" && !strings.HasPrefix(token, "ghp_") {
-						return errors.New("provided token malformed, must use a valid GitHub token")
-					}
-					format := cCtx.String("formatting")
-					if format != "discord" && format != "terminal" {
-						format = "terminal"
-					}
-
-					timestamp, err := SanitizeTimestamp(cCtx.String("start-date"))
+					formatter, err := getFormatter(cCtx)
 					if err != nil {
 						return err
 					}
 
-					client, err := auth.GetClient(org, branch, repos, timestamp, token)
+					client, err := newScanClient(cCtx)
 					if err != nil {
 						return err
 					}
@@ -115,44 +199,151 @@ func main() {
 						zap.S().Error(err)
 					}
 
+					// Find PRs that were reverted after being merged
+					prs, reverts, err := github.ApplyReverts(client, prs, repoList, cCtx.String("reverts"))
+					if err != nil {
+						zap.S().Error(err)
+					}
+
 					// Print out the PRs
-					return PrintPRList(prs, format)
+					return formatter.Format(&Report{
+						Command:  "all-prs",
+						Org:      client.Org,
+						Branch:   client.Branch,
+						Date:     client.Date,
+						EndDate:  client.EndDate,
+						SinceTag: client.SinceTag,
+						UntilTag: client.UntilTag,
+						PRs:      prs,
+						Reverts:  reverts,
+						Excluded: client.Exclusions.Counts(),
+					})
 				},
 			},
 			{
 				Name:  "unmerged-prs",
-				Usage: "Gather PRs merged into the master/main branch, but not the specified release branch after the specified date",
+				Usage: "Gather PRs merged into the master/main branch after the specified date, but not into the specified release branches",
+				Flags: unmergedFlags(),
 				Action: func(cCtx *cli.Context) error {
-					org := cCtx.String("organization")
-					branch := cCtx.String("release-branch")
-					repos := cCtx.StringSlice("repos")
-					token := cCtx.String("token")
-					if token != "" && !strings.HasPrefix(token, "ghp_") {
-						return errors.New("provided token malformed, must use a valid GitHub token")
-					}
-					format := cCtx.String("formatting")
-					if format != "discord" && format != "terminal" {
-						format = "terminal"
+					formatter, err := getFormatter(cCtx)
+					if err != nil {
+						return err
 					}
 
-					timestamp, err := SanitizeTimestamp(cCtx.String("start-date"))
+					_, report, err := gatherUnmergedPRs(cCtx)
 					if err != nil {
 						return err
 					}
+					return formatter.Format(report)
+				},
+			},
+			{
+				Name:  "backport",
+				Usage: "Open PRs against the release branches that cherry-pick the selected PRs merged into the master/main branch",
+				Flags: append([]cli.Flag{
+					&cli.StringSliceFlag{
+						Name:    "pr",
+						Aliases: []string{"p"},
+						Usage:   "PR to backport, format REPO#NUMBER. It is only backported to the release branches of its repo that do not contain it yet",
+					},
+					&cli.BoolFlag{
+						Name:  "all",
+						Usage: "backport every PR unmerged-prs would report",
+					},
+				}, append(unmergedFlags(), planFlags()...)...),
+				Action: func(cCtx *cli.Context) error {
+					refs := cCtx.StringSlice("pr")
+					if len(refs) == 0 && !cCtx.Bool("all") {
+						return errors.New("select PRs to backport with 'pr', or every unmerged PR with 'all'")
+					}
 
-					client, err := auth.GetClient(org, branch, repos, timestamp, token)
+					// Select the PRs to backport to each release branch
+					var client *auth.GithubClient
+					var branches []string
+					branchPRs := map[string]map[string][]*gogithub.PullRequest{}
+					if len(refs) != 0 {
+						var report *Report
+						var err error
+						strategies, err := github.ParseMatchStrategies(cCtx.StringSlice("match"))
+						if err != nil {
+							return err
+						}
+						client, report, err = gatherReferencedPRs(cCtx, refs)
+						if err != nil {
+							return err
+						}
+
+						// Only backport to the release branches the repository of
+						// each PR has and that do not contain it yet
+						matrix, _, err := github.BuildBranchMatrix(client, referencedRepos(report.PRs), report.PRs, &github.LabelPolicy{}, strategies)
+						if err != nil {
+							if matrix == nil {
+								return err
+							}
+							zap.S().Error(err)
+						}
+						branches = matrix.Branches
+						for _, branch := range branches {
+							for repoName, prs := range report.PRs {
+								for _, pr := range prs {
+									switch matrix.State(pr, branch) {
+									case github.StateNoReleaseBranch:
+										zap.S().Warnf("skipping PR #%d on repo %s for %s, the repo has no such branch", pr.GetNumber(), repoName, branch)
+									case github.StateContained:
+										zap.S().Infof("skipping PR #%d on repo %s for %s, it is already on the branch", pr.GetNumber(), repoName, branch)
+									}
+								}
+							}
+							branchPRs[branch] = matrix.MissingOn(branch, report.PRs)
+						}
+					} else {
+						var report *Report
+						var err error
+						client, report, err = gatherUnmergedPRs(cCtx)
+						if err != nil {
+							return err
+						}
+						// Reverted changes and their reverts cancel out, so
+						// neither is backported even when reverts are flagged
+						prs := report.Reverts.Drop(report.PRs)
+						branches = report.Matrix.Branches
+						for _, branch := range branches {
+							branchPRs[branch] = report.Matrix.MissingOn(branch, prs)
+						}
+					}
+
+					return applyPlan(cCtx, client, github.PlanBackports(client, branchPRs))
+				},
+			},
+			{
+				Name:  "changelog",
+				Usage: "Generate a Markdown changelog of all PRs merged into the master/main branch after the specified date",
+				Flags: []cli.Flag{
+					&cli.StringSliceFlag{
+						Name:    "label-section",
+						Aliases: []string{"s"},
+						Usage:   "map a label to a changelog section, format LABEL=SECTION. Overrides the default mapping for that label",
+					},
+					&cli.StringFlag{
+						Name:      "output",
+						Usage:     "write the changelog to a file instead of stdout",
+						TakesFile: true,
+					},
+				},
+				Action: func(cCtx *cli.Context) error {
+
+					sections, err := ParseChangelogSections(cCtx.StringSlice("label-section"))
 					if err != nil {
 						return err
 					}
 
-					// Gather repositories to check
-					repoList, err := github.GatherRepositories(client)
+					client, err := newScanClient(cCtx)
 					if err != nil {
 						return err
 					}
 
-					// Gather repositories with release branches to compare with
-					releaseRepos, err := github.GatherReleaseRepositories(client, repoList)
+					// Gather repositories to check
+					repoList, err := github.GatherRepositories(client)
 					if err != nil {
 						return err
 					}
@@ -166,47 +357,148 @@ func main() {
 						zap.S().Error(err)
 					}
 
-					finalPrs, err := github.FilterMatchingCommitsOnBranch(client, prs, releaseRepos)
+					// Find PRs that were reverted after being merged
+					prs, reverts, err := github.ApplyReverts(client, prs, repoList, cCtx.String("reverts"))
 					if err != nil {
-						if len(finalPrs) == 0 {
-							return err
-						}
 						zap.S().Error(err)
 					}
 
-					return PrintPRList(finalPrs, format)
+					report := &Report{
+						Command:  "changelog",
+						Org:      client.Org,
+						Branch:   client.Branch,
+						Date:     client.Date,
+						EndDate:  client.EndDate,
+						SinceTag: client.SinceTag,
+						UntilTag: client.UntilTag,
+						PRs:      prs,
+						Reverts:  reverts,
+						Excluded: client.Exclusions.Counts(),
+					}
+
+					output := cCtx.String("output")
+					if output == "" {
+						return WriteChangelog(os.Stdout, report, sections)
+					}
+
+					fi, err := os.Create(output)
+					if err != nil {
+						return fmt.Errorf("failed to create changelog file: %w", err)
+					}
+					defer fi.Close()
+
+					if err := WriteChangelog(fi, report, sections); err != nil {
+						return err
+					}
+					zap.S().Named("output").Infof("Wrote changelog to %s", output)
+					return nil
 				},
 			},
 			{
 				Name:  "add-protections",
-				Usage: "Add branch protection rules to any repos with a branch matching the provided 'release-branch' option",
+				Usage: "Add branch protection rules to any repos with a branch matching the provided 'release-branch' options",
+				Flags: append([]cli.Flag{
+					protectionProfilesFlag(),
+					&cli.StringFlag{
+						Name:  "mode",
+						Value: github.ProtectClassic,
+						Usage: "how rules are applied. Either 'classic' for branch protection rules, 'repo-ruleset' for a ruleset on each repo, or 'org-ruleset' for a single organization ruleset",
+					},
+					&cli.StringFlag{
+						Name:  "ruleset-name",
+						Value: internal.DefaultRulesetName,
+						Usage: "name of the ruleset created or updated by the ruleset modes",
+					},
+				}, planFlags()...),
 				Action: func(cCtx *cli.Context) error {
-					org := cCtx.String("organization")
-					branch := cCtx.String("release-branch")
-					repos := cCtx.StringSlice("repos")
-					token := cCtx.String("token")
-					if token != "" && !strings.HasPrefix(token, "ghp_") {
-						return errors.New("provided token malformed, must use a valid GitHub token")
+					mode := cCtx.String("mode")
+					if err := github.CheckProtectMode(mode); err != nil {
+						return err
+					}
+
+					profiles, err := loadProfiles(cCtx)
+					if err != nil {
+						return err
 					}
 
-					client, err := auth.GetClient(org, branch, repos, time.Now(), token)
+					client, err := newClient(cCtx, time.Now())
 					if err != nil {
 						return err
 					}
 
-					updatedRepos, err := github.UpdateBranchRules(client)
-					if len(updatedRepos) != 0 {
-						for _, repo := range updatedRepos {
-							zap.S().Named("output").Infof("Added branch protection rule for %s to repo %s/%s", client.Branch, client.Org, repo.GetName())
+					var plan *github.Plan
+					switch mode {
+					case github.ProtectRepoRuleset:
+						plan, err = github.PlanRepoRulesets(client, profiles, cCtx.String("ruleset-name"))
+					case github.ProtectOrgRuleset:
+						plan, err = github.PlanOrgRuleset(client, profiles, cCtx.String("ruleset-name"))
+					default:
+						plan, err = github.PlanBranchRules(client, profiles)
+					}
+					if err != nil {
+						if plan == nil {
+							return err
 						}
+						zap.S().Error(err)
 					}
-					return err
+					return applyPlan(cCtx, client, plan)
+				},
+			},
+			{
+				Name:  "protections",
+				Usage: "Inspect branch protection rules of repos with a branch matching the provided 'release-branch' options",
+				Subcommands: []*cli.Command{
+					{
+						Name:  "audit",
+						Usage: "Compare existing branch protection rules with their profile field by field, reporting drift",
+						Flags: append([]cli.Flag{
+							protectionProfilesFlag(),
+							&cli.BoolFlag{
+								Name:  "enforce",
+								Usage: "update rules that do not comply with their profile",
+							},
+						}, planFlags()...),
+						Action: func(cCtx *cli.Context) error {
+							format := cCtx.String("formatting")
+							if format != "terminal" && format != "json" {
+								return fmt.Errorf("unsupported format option %s for protections audit, allowed: 'terminal', 'json'", format)
+							}
+
+							profiles, err := loadProfiles(cCtx)
+							if err != nil {
+								return err
+							}
+
+							client, err := newClient(cCtx, time.Now())
+							if err != nil {
+								return err
+							}
+
+							drifts, auditErr := github.AuditBranchRules(client, profiles)
+							if auditErr != nil {
+								if drifts == nil {
+									return auditErr
+								}
+								zap.S().Error(auditErr)
+							}
+
+							if format == "json" {
+								err = printProtectionAuditJSON(client.Org, drifts)
+							} else {
+								printProtectionAudit(drifts)
+							}
+							if err != nil || !cCtx.Bool("enforce") {
+								return errors.Join(err, auditErr)
+							}
+							return applyPlan(cCtx, client, github.PlanEnforcement(drifts))
+						},
+					},
 				},
 			},
 			{
 				Name:  "add-label",
 				Usage: "Create or edit a label on the specified repositories",
-				Flags: []cli.Flag{
+				Flags: append([]cli.Flag{
 					&cli.StringFlag{
 						Name:    "name",
 						Aliases: []string{"n"},
@@ -231,17 +523,10 @@ func main() {
 						Name:  "update-only",
 						Usage: "Should new labels be made, or update existing only",
 					},
-				},
+				}, planFlags()...),
 				Action: func(cCtx *cli.Context) error {
-					org := cCtx.String("organization")
-					branch := cCtx.String("release-branch")
-					repos := cCtx.StringSlice("repos")
-					token := cCtx.String("token")
-					if token != "" && !strings.HasPrefix(token, "ghp_") {
-						return errors.New("provided token malformed, must use a valid GitHub token")
-					}
 
-					client, err := auth.GetClient(org, branch, repos, time.Time{}, token)
+					client, err := newClient(cCtx, time.Time{})
 					if err != nil {
 						return err
 					}
@@ -252,24 +537,496 @@ func main() {
 						return err
 					}
 
-					return github.CreateLabelOnRepositories(client, repoList, &github.LabelData{
+					plan, err := github.PlanLabel(client, repoList, &github.LabelData{
 						Name:       cCtx.String("name"),
 						OldName:    cCtx.String("old-name"),
 						Color:      cCtx.String("color"),
 						Desc:       cCtx.String("desc"),
 						UpdateOnly: cCtx.Bool("update-only"),
 					})
+					if err != nil {
+						if plan == nil {
+							return err
+						}
+						zap.S().Error(err)
+					}
+					return applyPlan(cCtx, client, plan)
+				},
+			},
+			{
+				Name:  "labels",
+				Usage: "Manage the labels of the specified repositories",
+				Subcommands: []*cli.Command{
+					{
+						Name:      "sync",
+						Usage:     "Reconcile the labels of the specified repositories with a YAML or JSON labels manifest",
+						ArgsUsage: "FILE",
+						Flags: append([]cli.Flag{
+							&cli.BoolFlag{
+								Name:  "prune",
+								Usage: "delete labels that are not in the manifest",
+							},
+						}, planFlags()...),
+						Action: func(cCtx *cli.Context) error {
+							if cCtx.NArg() != 1 {
+								return errors.New("pass the labels manifest to sync to")
+							}
+							manifest, err := github.LoadLabelManifest(cCtx.Args().First())
+							if err != nil {
+								return err
+							}
+
+							client, err := newClient(cCtx, time.Time{})
+							if err != nil {
+								return err
+							}
+
+							repoList, err := github.GatherRepositories(client)
+							if err != nil {
+								return err
+							}
+
+							plan, err := github.PlanLabelSync(client, repoList, manifest, cCtx.Bool("prune"))
+							if err != nil {
+								if plan == nil {
+									return err
+								}
+								zap.S().Error(err)
+							}
+							return applyPlan(cCtx, client, plan)
+						},
+					},
+					{
+						Name:  "merge",
+						Usage: "Move every issue and PR from one label to another on the specified repositories, then delete the old label. Run again to resume an interrupted merge",
+						Flags: append([]cli.Flag{
+							&cli.StringFlag{
+								Name:     "from",
+								Usage:    "The label to merge and delete",
+								Required: true,
+							},
+							&cli.StringFlag{
+								Name:     "into",
+								Usage:    "The label to merge into, created by renaming the old label where missing",
+								Required: true,
+							},
+						}, planFlags()...),
+						Action: func(cCtx *cli.Context) error {
+							client, err := newClient(cCtx, time.Time{})
+							if err != nil {
+								return err
+							}
+
+							repoList, err := github.GatherRepositories(client)
+							if err != nil {
+								return err
+							}
+
+							plan, err := github.PlanLabelMerge(client, repoList, cCtx.String("from"), cCtx.String("into"))
+							if err != nil {
+								if plan == nil {
+									return err
+								}
+								zap.S().Error(err)
+							}
+							return applyPlan(cCtx, client, plan)
+						},
+					},
+					{
+						Name:  "audit",
+						Usage: "List the labels of the specified repositories with their usage, grouping near-duplicate names",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:      "manifest",
+								Usage:     "write a labels manifest suggested by the audit to this file, for use with 'labels sync'",
+								TakesFile: true,
+							},
+						},
+						Action: func(cCtx *cli.Context) error {
+							format := cCtx.String("formatting")
+							if format != "terminal" && format != "json" {
+								return fmt.Errorf("unsupported format option %s for labels audit, allowed: 'terminal', 'json'", format)
+							}
+
+							client, err := newClient(cCtx, time.Time{})
+							if err != nil {
+								return err
+							}
+
+							repoList, err := github.GatherRepositories(client)
+							if err != nil {
+								return err
+							}
+
+							clusters, auditErr := github.AuditLabels(client, repoList)
+							if auditErr != nil {
+								if clusters == nil {
+									return auditErr
+								}
+								zap.S().Error(auditErr)
+							}
+
+							if format == "json" {
+								err = printLabelAuditJSON(client.Org, clusters)
+							} else {
+								printLabelAudit(clusters)
+							}
+							if file := cCtx.String("manifest"); err == nil && file != "" {
+								err = github.WriteLabelManifest(file, github.SuggestLabelManifest(clusters))
+								if err == nil {
+									zap.S().Infof("Wrote suggested labels manifest to %s", file)
+								}
+							}
+							return errors.Join(err, auditErr)
+						},
+					},
+				},
+			},
+			{
+				Name:  "cache",
+				Usage: "Manage the on-disk cache of GitHub responses",
+				Subcommands: []*cli.Command{
+					{
+						Name:  "clear",
+						Usage: "Remove all cached GitHub responses",
+						Action: func(*cli.Context) error {
+							dir, err := auth.ClearCache()
+							if err != nil {
+								return err
+							}
+							zap.S().Named("output").Infof("Cleared cache at %s", dir)
+							return nil
+						},
+					},
 				},
 			},
 		},
 	}
 
-	if err := app.Run(os.Args); err != nil {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if err := app.RunContext(ctx, os.Args); err != nil {
 		zap.S().Error(err)
+		stop()
 		os.Exit(1)
 	}
 }
 
+// unmergedFlags are the flags selecting which PRs are reported as missing
+// from the release branch.
+func unmergedFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringSliceFlag{
+			Name:    "match",
+			Aliases: []string{"m"},
+			Usage:   "strategies used to find PRs on the release branch, in order: 'number', 'cherry-pick', 'patch-id'",
+			Value:   cli.NewStringSlice("number", "cherry-pick"),
+		},
+		&cli.StringSliceFlag{
+			Name:  "require-label",
+			Usage: "only report PRs carrying at least one of these labels",
+		},
+		&cli.StringSliceFlag{
+			Name:  "exclude-label",
+			Usage: "do not report PRs carrying any of these labels as missing from the release branches. Unlike the global 'exclude-pr-label', this is part of the label policy with 'require-label' and 'branch-label', and the PRs are not counted in the excluded totals",
+		},
+		&cli.StringSliceFlag{
+			Name:  "branch-label",
+			Usage: "map a label to the release branch its PRs are intended for, format LABEL=BRANCH. PRs with a mapped label are only reported for those branches",
+		},
+	}
+}
+
+// protectionProfilesFlag is the flag selecting the branch protection profiles.
+func protectionProfilesFlag() cli.Flag {
+	return &cli.StringFlag{
+		Name:        "protection-profiles",
+		Usage:       "YAML or JSON file of protection profiles to apply, selected by branch pattern with per-repo overrides",
+		DefaultText: "one approval including code owners, passing build and resolved conversations",
+		TakesFile:   true,
+	}
+}
+
+// loadProfiles loads the branch protection profiles selected by the flags.
+func loadProfiles(cCtx *cli.Context) ([]*github.ProtectionProfile, error) {
+	if file := cCtx.String("protection-profiles"); file != "" {
+		return github.LoadProtectionProfiles(file)
+	}
+	if len(activeProfile.Protection) != 0 {
+		return activeProfile.Protection, nil
+	}
+	return github.DefaultProtectionProfiles(), nil
+}
+
+// planFlags are the flags controlling how planned changes are applied.
+func planFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "dry-run",
+			Usage: "print the changes that would be made without making them",
+		},
+		&cli.BoolFlag{
+			Name:    "yes",
+			Aliases: []string{"y"},
+			Usage:   "make the changes without asking for confirmation",
+		},
+	}
+}
+
+// applyPlan prints the planned changes, then applies them unless this is a
+// dry run or the user does not confirm them.
+func applyPlan(cCtx *cli.Context, client *auth.GithubClient, plan *github.Plan) error {
+	printPlan(plan)
+	if len(plan.Changes) == 0 || cCtx.Bool("dry-run") {
+		return nil
+	}
+
+	if !cCtx.Bool("yes") {
+		fmt.Fprintf(os.Stderr, "Apply %d changes? [y/N] ", len(plan.Changes))
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		answer = strings.ToLower(strings.TrimSpace(answer))
+		if answer != "y" && answer != "yes" {
+			return errors.New("changes not applied, pass 'yes' to apply them without confirmation")
+		}
+	}
+
+	applied, err := plan.Apply(client)
+	zap.S().Named("output").Infof("Applied %d of %d changes", len(applied), len(plan.Changes))
+	return err
+}
+
+// printPlan prints the planned changes with the fields they modify.
+func printPlan(plan *github.Plan) {
+	if len(plan.Changes) == 0 {
+		zap.S().Named("output").Info("No changes needed")
+		return
+	}
+
+	zap.S().Named("output").Info("Planned changes:")
+	zap.S().Named("output").Info()
+	for _, change := range plan.Changes {
+		if change.Repo == "" {
+			zap.S().Named("output").Infof("%s: %s", change.Target, change.Action)
+		} else {
+			zap.S().Named("output").Infof("%s %s: %s", change.Repo, change.Target, change.Action)
+		}
+		for _, field := range change.Fields {
+			zap.S().Named("output").Infof("    %s: %s -> %s", field.Field, field.Current, field.Desired)
+		}
+	}
+	zap.S().Named("output").Info()
+}
+
+// gatherUnmergedPRs gathers the PRs merged into the master/main branch after
+// the specified date that are not on one of the release branches.
+func gatherUnmergedPRs(cCtx *cli.Context) (*auth.GithubClient, *Report, error) {
+	strategies, err := github.ParseMatchStrategies(cCtx.StringSlice("match"))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	branchLabels, err := configBranchLabels(cCtx)
+	if err != nil {
+		return nil, nil, err
+	}
+	policy := &github.LabelPolicy{
+		Require:  configStrings(cCtx, "require-label", activeProfile.RequireLabels),
+		Exclude:  configStrings(cCtx, "exclude-label", activeProfile.ExcludeLabels),
+		Branches: branchLabels,
+	}
+
+	client, err := newScanClient(cCtx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Gather repositories to check
+	repoList, err := github.GatherRepositories(client)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Gather all PRs merged after the specified date
+	prs, err := github.GatherMergedPRs(client, repoList)
+	if err != nil {
+		if len(prs) == 0 {
+			return nil, nil, err
+		}
+		zap.S().Error(err)
+	}
+
+	// Find PRs that were reverted after being merged
+	prs, reverts, err := github.ApplyReverts(client, prs, repoList, cCtx.String("reverts"))
+	if err != nil {
+		zap.S().Error(err)
+	}
+
+	// Check which release branches each PR intended for them is missing from
+	matrix, finalPrs, err := github.BuildBranchMatrix(client, repoList, prs, policy, strategies)
+	if err != nil {
+		if len(finalPrs) == 0 {
+			return nil, nil, err
+		}
+		zap.S().Error(err)
+	}
+
+	return client, &Report{
+		Command:  cCtx.Command.Name,
+		Org:      client.Org,
+		Branch:   client.Branch,
+		Date:     client.Date,
+		EndDate:  client.EndDate,
+		SinceTag: client.SinceTag,
+		UntilTag: client.UntilTag,
+		PRs:      finalPrs,
+		Matrix:   matrix,
+		Reverts:  reverts,
+		Excluded: client.Exclusions.Counts(),
+	}, nil
+}
+
+// gatherReferencedPRs gathers the merged PRs referenced in REPO#NUMBER format.
+func gatherReferencedPRs(cCtx *cli.Context, refs []string) (*auth.GithubClient, *Report, error) {
+	client, err := newClient(cCtx, time.Time{})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	prs, err := github.GatherPRsByReference(client, refs)
+	if err != nil {
+		if len(prs) == 0 {
+			return nil, nil, err
+		}
+		zap.S().Error(err)
+	}
+
+	// Nothing matching the PRs can be on a release branch before they were
+	// merged, so only look at commits from the earliest merge on
+	for _, repoPRs := range prs {
+		for _, pr := range repoPRs {
+			if merged := pr.GetMergedAt().Time; client.Date.IsZero() || merged.Before(client.Date) {
+				client.Date = merged
+			}
+		}
+	}
+
+	return client, &Report{
+		Command: cCtx.Command.Name,
+		Org:     client.Org,
+		Branch:  client.Branch,
+		PRs:     prs,
+	}, nil
+}
+
+// referencedRepos returns the repositories of the passed PRs.
+func referencedRepos(prMap map[string][]*gogithub.PullRequest) []*gogithub.Repository {
+	var repos []*gogithub.Repository
+	for _, k := range sortedRepoNames(prMap) {
+		if repo := prMap[k][0].GetBase().GetRepo(); repo != nil {
+			repos = append(repos, repo)
+		}
+	}
+	return repos
+}
+
+// newClient creates a GitHub client configured by the global flags, searching
+// for PRs after the passed timestamp.
+func newClient(cCtx *cli.Context, timestamp time.Time) (*auth.GithubClient, error) {
+	opts, err := clientOptions(cCtx)
+	if err != nil {
+		return nil, err
+	}
+	opts.Date = timestamp
+	return auth.GetClient(cCtx.Context, opts)
+}
+
+// newScanClient creates a GitHub client configured by the global flags,
+// searching for PRs within the window selected by the date and tag flags.
+func newScanClient(cCtx *cli.Context) (*auth.GithubClient, error) {
+	opts, err := clientOptions(cCtx)
+	if err != nil {
+		return nil, err
+	}
+
+	opts.Date, err = SanitizeTimestamp("start-date", cCtx.String("start-date"))
+	if err != nil {
+		return nil, err
+	}
+	if cCtx.String("end-date") != "" {
+		opts.EndDate, err = SanitizeEndTimestamp("end-date", cCtx.String("end-date"))
+		if err != nil {
+			return nil, err
+		}
+	}
+	opts.SinceTag = cCtx.String("since-tag")
+	opts.UntilTag = cCtx.String("until-tag")
+	return auth.GetClient(cCtx.Context, opts)
+}
+
+// clientOptions collects the client settings of the global flags.
+func clientOptions(cCtx *cli.Context) (*auth.ClientOptions, error) {
+	token := cCtx.String("token")
+	if token != "" && !strings.HasPrefix(token, "ghp_") {
+		return nil, errors.New("provided token malformed, must use a valid GitHub token")
+	}
+
+	exclusions, err := exclusionsOptions(cCtx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &auth.ClientOptions{
+		Org:         cCtx.String("organization"),
+		Branches:    cCtx.StringSlice("release-branch"),
+		Repos:       cCtx.StringSlice("repos"),
+		Token:       token,
+		Concurrency: cCtx.Int("concurrency"),
+		NoCache:     cCtx.Bool("no-cache"),
+		API:         cCtx.String("api"),
+		Exclusions:  exclusions,
+	}, nil
+}
+
+// exclusionsOptions compiles the repository and PR exclusions of the flags.
+func exclusionsOptions(cCtx *cli.Context) (*internal.Exclusions, error) {
+	repos, err := internal.ParsePatterns(cCtx.StringSlice("exclude-repo"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid 'exclude-repo' option: %w", err)
+	}
+	titles, err := internal.ParsePatterns(cCtx.StringSlice("exclude-title"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid 'exclude-title' option: %w", err)
+	}
+	authors, err := internal.ParsePatterns(cCtx.StringSlice("exclude-author"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid 'exclude-author' option: %w", err)
+	}
+	return &internal.Exclusions{
+		Repos:   repos,
+		Titles:  titles,
+		Authors: authors,
+		Labels:  cCtx.StringSlice("exclude-pr-label"),
+	}, nil
+}
+
+// getFormatter constructs the formatter selected by the global flags.
+func getFormatter(cCtx *cli.Context) (Formatter, error) {
+	format := configString(cCtx, "formatting", activeProfile.Formatting)
+	templateFile := configString(cCtx, "template", activeProfile.Template)
+	if templateFile != "" {
+		format = "template"
+	} else if cCtx.String("discord-webhook") != "" && !cCtx.IsSet("formatting") && activeProfile.Formatting == "" {
+		format = "discord"
+	}
+	return NewFormatter(format, &FormatterOptions{
+		Ctx:             cCtx.Context,
+		TemplateFile:    templateFile,
+		DiscordChunkDir: cCtx.String("discord-chunk-dir"),
+		DiscordWebhook:  cCtx.String("discord-webhook"),
+	})
+}
+
 func init() {
 	zap.ReplaceGlobals(zap.New(zapcore.NewCore(
 		zapcore.NewConsoleEncoder(zapcore.EncoderConfig{
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+
+	"github.com/urfave/cli/v2"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+
+	"github.com/serenibyss/nhprtracker/github"
+	"github.com/serenibyss/nhprtracker/internal"
+)
+
+// defaultConfigProfile is the profile used when neither the 'profile' flag
+// nor the config file selects one.
+const defaultConfigProfile = "default"
+
+// Config is the layout of the config file.
+type Config struct {
+	// DefaultProfile is the profile used when the 'profile' flag is not set.
+	DefaultProfile string                    `yaml:"default_profile"`
+	Profiles       map[string]*ConfigProfile `yaml:"profiles"`
+}
+
+// ConfigProfile holds values of flags not set on the command line, so they do
+// not need to be passed again for every command of a release cycle.
+type ConfigProfile struct {
+	Organization    string   `yaml:"organization"`
+	ReleaseBranches []string `yaml:"release_branches"`
+	StartDate       string   `yaml:"start_date"`
+	EndDate         string   `yaml:"end_date"`
+	SinceTag        string   `yaml:"since_tag"`
+	UntilTag        string   `yaml:"until_tag"`
+	Repos           []string `yaml:"repos"`
+	Concurrency     int      `yaml:"concurrency"`
+	API             string   `yaml:"api"`
+	Reverts         string   `yaml:"reverts"`
+
+	// Formatting and Template select the output of the PR reports of
+	// all-prs and unmerged-prs. Audits keep their own output unless the flags
+	// are passed.
+	Formatting string `yaml:"formatting"`
+	Template   string `yaml:"template"`
+
+	// Exclusions replace the default repositories and PRs left out of
+	// reports.
+	Exclusions ConfigExclusions `yaml:"exclusions"`
+
+	// RequireLabels, ExcludeLabels and BranchLabels are the label policy
+	// selecting the PRs reported by unmerged-prs and backport. Unlike
+	// Exclusions.Labels, they do not apply to other commands.
+	RequireLabels []string `yaml:"require_labels"`
+	ExcludeLabels []string `yaml:"exclude_labels"`
+
+	// BranchLabels maps labels to the release branches PRs carrying them are
+	// intended for, like the 'branch-label' flag.
+	BranchLabels map[string][]string `yaml:"branch_labels"`
+
+	// Protection holds the profiles applied by add-protections and
+	// protections audit when no profiles file is passed.
+	Protection []*github.ProtectionProfile `yaml:"protection"`
+}
+
+// ConfigExclusions holds the values of the exclusion flags, applied to every
+// report. Repos, titles and authors are globs, or regular expressions prefixed
+// with "re:".
+type ConfigExclusions struct {
+	Repos   []string `yaml:"repos"`
+	Titles  []string `yaml:"titles"`
+	Authors []string `yaml:"authors"`
+	Labels  []string `yaml:"labels"`
+}
+
+// activeProfile is the config profile selected for this run, empty if there
+// is none.
+var activeProfile = &ConfigProfile{}
+
+// defaultConfigFile returns the path of the config file read when the 'config'
+// flag is not set.
+func defaultConfigFile() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("could not find user config directory: %w", err)
+	}
+	return filepath.Join(dir, internal.AppName, "config.yaml"), nil
+}
+
+// loadConfig reads the config file and selects the profile of this run. A
+// missing config file is only an error if it was passed explicitly.
+func loadConfig(cCtx *cli.Context) (*ConfigProfile, error) {
+	file := cCtx.String("config")
+	if file == "" {
+		var err error
+		file, err = defaultConfigFile()
+		if err != nil {
+			if cCtx.IsSet("profile") {
+				return nil, err
+			}
+			zap.S().Debug(err)
+			return nil, nil
+		}
+	}
+
+	data, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) && !cCtx.IsSet("config") {
+		if cCtx.IsSet("profile") {
+			return nil, fmt.Errorf("could not select profile %s, no config file at %s", cCtx.String("profile"), file)
+		}
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+
+	var config Config
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse config %s: %w", file, err)
+	}
+
+	name := cCtx.String("profile")
+	if name == "" {
+		name = config.DefaultProfile
+	}
+	if name == "" {
+		name = defaultConfigProfile
+		if _, ok := config.Profiles[name]; !ok {
+			zap.S().Debugf("no profile selected in config %s", file)
+			return nil, nil
+		}
+	}
+
+	profile, ok := config.Profiles[name]
+	if !ok || profile == nil {
+		return nil, fmt.Errorf("no profile named %s in config %s", name, file)
+	}
+	if len(profile.Protection) != 0 {
+		if err := github.CheckProtectionProfiles(profile.Protection, file); err != nil {
+			return nil, err
+		}
+	}
+	zap.S().Debugf("using profile %s from config %s", name, file)
+	return profile, nil
+}
+
+// applyConfig sets the global flags not set on the command line to the values
+// of the profile.
+func applyConfig(cCtx *cli.Context, profile *ConfigProfile) error {
+	values := map[string][]string{
+		"organization":     {profile.Organization},
+		"release-branch":   profile.ReleaseBranches,
+		"start-date":       {profile.StartDate},
+		"end-date":         {profile.EndDate},
+		"since-tag":        {profile.SinceTag},
+		"until-tag":        {profile.UntilTag},
+		"repos":            profile.Repos,
+		"api":              {profile.API},
+		"reverts":          {profile.Reverts},
+		"exclude-repo":     profile.Exclusions.Repos,
+		"exclude-title":    profile.Exclusions.Titles,
+		"exclude-author":   profile.Exclusions.Authors,
+		"exclude-pr-label": profile.Exclusions.Labels,
+	}
+	if profile.Concurrency != 0 {
+		values["concurrency"] = []string{strconv.Itoa(profile.Concurrency)}
+	}
+
+	for name, flagValues := range values {
+		if cCtx.IsSet(name) {
+			continue
+		}
+		for _, value := range flagValues {
+			if value == "" {
+				continue
+			}
+			if err := cCtx.Set(name, value); err != nil {
+				return fmt.Errorf("invalid config value %q for %s: %w", value, name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// configString returns the value of a flag, falling back to the value of the
+// config profile when the flag is not set.
+func configString(cCtx *cli.Context, name, value string) string {
+	if cCtx.IsSet(name) || value == "" {
+		return cCtx.String(name)
+	}
+	return value
+}
+
+// configStrings returns the values of a flag, falling back to the values of
+// the config profile when the flag is not set.
+func configStrings(cCtx *cli.Context, name string, values []string) []string {
+	if cCtx.IsSet(name) || len(values) == 0 {
+		return cCtx.StringSlice(name)
+	}
+	return slices.Clone(values)
+}
+
+// configBranchLabels returns the label to release branch mappings of the
+// 'branch-label' flag, falling back to the mappings of the config profile
+// when the flag is not set.
+func configBranchLabels(cCtx *cli.Context) (map[string][]string, error) {
+	if cCtx.IsSet("branch-label") || len(activeProfile.BranchLabels) == 0 {
+		return github.ParseBranchLabels(cCtx.StringSlice("branch-label"))
+	}
+
+	branches := map[string][]string{}
+	for label, labelBranches := range activeProfile.BranchLabels {
+		if label == "" || len(labelBranches) == 0 || slices.Contains(labelBranches, "") {
+			return nil, fmt.Errorf("config branch label %q malformed, must map a label to release branches", label)
+		}
+		branches[label] = slices.Clone(labelBranches)
+	}
+	return branches, nil
+}
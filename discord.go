@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"go.uber.org/zap"
+
+	"github.com/serenibyss/nhprtracker/discord"
+)
+
+// discordMessageLimit is the maximum number of characters in a discord message.
+const discordMessageLimit = 2000
+
+// discordEmbedColor is the accent color of the embeds posted to a webhook.
+const discordEmbedColor = 0x2b7bb9
+
+func newDiscordFormatter(opts *FormatterOptions) (Formatter, error) {
+	if opts.DiscordWebhook != "" {
+		webhook, err := discord.NewWebhook(opts.DiscordWebhook, &http.Client{Timeout: 30 * time.Second})
+		if err != nil {
+			return nil, err
+		}
+		ctx := opts.Ctx
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		return FormatterFunc(func(report *Report) error {
+			return postDiscordMessages(ctx, webhook, report)
+		}), nil
+	}
+
+	return FormatterFunc(func(report *Report) error {
+		messages := chunkDiscordSections(discordSections(report), discordMessageLimit)
+		if opts.DiscordChunkDir != "" {
+			return writeDiscordMessages(opts.DiscordChunkDir, messages)
+		}
+		printDiscordMessages(messages)
+		return nil
+	}), nil
+}
+
+// discordSection is the heading and PR lines for a single repository.
+type discordSection struct {
+	Repo  string
+	Lines []string
+}
+
+func discordSections(report *Report) []discordSection {
+	var sections []discordSection
+	for _, k := range report.Repos() {
+		section := discordSection{Repo: k}
+		for _, pr := range report.PRs[k] {
+			line := fmt.Sprintf("- #%d: [%s](<%s>)", pr.GetNumber(), pr.GetTitle(), pr.GetHTMLURL())
+			for _, note := range report.Notes(pr) {
+				line += fmt.Sprintf(" *(%s)*", note)
+			}
+			section.Lines = append(section.Lines, line)
+		}
+		sections = append(sections, section)
+	}
+	return sections
+}
+
+// chunkDiscordSections packs repository sections into messages of at most
+// limit characters. Sections are only split when they do not fit into a
+// message of their own, in which case they are split between lines and the
+// heading is repeated on the following message.
+func chunkDiscordSections(sections []discordSection, limit int) []string {
+	var messages []string
+	var current strings.Builder
+
+	flush := func() {
+		if current.Len() != 0 {
+			messages = append(messages, strings.TrimRight(current.String(), "\n"))
+			current.Reset()
+		}
+	}
+	fits := func(text string) bool {
+		return utf8.RuneCountInString(current.String())+utf8.RuneCountInString(text) <= limit
+	}
+
+	for _, section := range sections {
+		text := fmt.Sprintf("**%s**:\n%s\n\n", section.Repo, strings.Join(section.Lines, "\n"))
+		if fits(strings.TrimRight(text, "\n")) {
+			current.WriteString(text)
+			continue
+		}
+		flush()
+		if fits(strings.TrimRight(text, "\n")) {
+			current.WriteString(text)
+			continue
+		}
+
+		// section is larger than a whole message, split it by line
+		contHeading := fmt.Sprintf("**%s** (cont.):\n", section.Repo)
+		current.WriteString(fmt.Sprintf("**%s**:\n", section.Repo))
+		for _, line := range section.Lines {
+			line = truncateRunes(line, limit-utf8.RuneCountInString(contHeading))
+			if !fits(line) {
+				flush()
+				current.WriteString(contHeading)
+			}
+			current.WriteString(line + "\n")
+		}
+		current.WriteString("\n")
+	}
+	flush()
+	return messages
+}
+
+// truncateRunes shortens text to at most n characters.
+func truncateRunes(text string, n int) string {
+	if utf8.RuneCountInString(text) <= n {
+		return text
+	}
+	if n < 1 {
+		return ""
+	}
+	runes := []rune(text)
+	return string(runes[:n-1]) + "…"
+}
+
+func printDiscordMessages(messages []string) {
+	if len(messages) > 1 {
+		zap.S().Named("output").Infof("Copy paste each of the %d messages below into discord", len(messages))
+	} else {
+		zap.S().Named("output").Info("Copy paste the below into discord")
+	}
+	fmt.Println()
+
+	for i, message := range messages {
+		if len(messages) > 1 {
+			fmt.Printf("----- message %d/%d -----\n", i+1, len(messages))
+		}
+		fmt.Println(message)
+		fmt.Println()
+	}
+}
+
+func writeDiscordMessages(dir string, messages []string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create discord chunk directory: %w", err)
+	}
+
+	for i, message := range messages {
+		path := filepath.Join(dir, fmt.Sprintf("discord-%03d.md", i+1))
+		if err := os.WriteFile(path, []byte(message+"\n"), 0o644); err != nil {
+			return fmt.Errorf("failed to write discord message %d: %w", i+1, err)
+		}
+		zap.S().Named("output").Infof("Wrote discord message %d/%d to %s", i+1, len(messages), path)
+	}
+	return nil
+}
+
+// discordEmbeds builds one embed per repository, splitting repositories with
+// more PRs than fit in a single embed description.
+func discordEmbeds(report *Report) []discord.Embed {
+	var embeds []discord.Embed
+	for _, k := range report.Repos() {
+		var lines []string
+		for _, pr := range report.PRs[k] {
+			line := fmt.Sprintf("- [#%d](%s): %s", pr.GetNumber(), pr.GetHTMLURL(), pr.GetTitle())
+			for _, note := range report.Notes(pr) {
+				line += fmt.Sprintf(" *(%s)*", note)
+			}
+			lines = append(lines, line)
+		}
+
+		title := truncateRunes(k, discord.MaxEmbedTitle)
+		for i, description := range splitLines(lines, discord.MaxEmbedDescription) {
+			embed := discord.Embed{
+				Title:       title,
+				URL:         "https://github.com/" + k,
+				Description: description,
+				Color:       discordEmbedColor,
+			}
+			if i > 0 {
+				embed.Title = truncateRunes(k+" (cont.)", discord.MaxEmbedTitle)
+			}
+			embeds = append(embeds, embed)
+		}
+	}
+	return embeds
+}
+
+// splitLines joins lines into blocks of at most limit characters.
+func splitLines(lines []string, limit int) []string {
+	var blocks []string
+	var current strings.Builder
+	for _, line := range lines {
+		line = truncateRunes(line, limit)
+		if current.Len() != 0 && utf8.RuneCountInString(current.String())+1+utf8.RuneCountInString(line) > limit {
+			blocks = append(blocks, current.String())
+			current.Reset()
+		}
+		if current.Len() != 0 {
+			current.WriteString("\n")
+		}
+		current.WriteString(line)
+	}
+	if current.Len() != 0 {
+		blocks = append(blocks, current.String())
+	}
+	return blocks
+}
+
+func postDiscordMessages(ctx context.Context, webhook *discord.Webhook, report *Report) error {
+	messages := discord.PackEmbeds(discordEmbeds(report))
+	if len(messages) == 0 {
+		messages = []*discord.Message{{Content: "No pull requests found."}}
+	}
+
+	for i, message := range messages {
+		if err := webhook.Send(ctx, message); err != nil {
+			return fmt.Errorf("failed to post discord message %d/%d: %w", i+1, len(messages), err)
+		}
+		zap.S().Named("output").Debugf("posted discord message %d/%d", i+1, len(messages))
+	}
+	zap.S().Named("output").Infof("Posted %d messages to discord webhook", len(messages))
+	return nil
+}
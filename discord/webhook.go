@@ -0,0 +1,197 @@
+package discord
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Limits imposed by discord on webhook messages.
+const (
+	MaxEmbedsPerMessage = 10
+	MaxEmbedTitle       = 256
+	MaxEmbedDescription = 4096
+	MaxEmbedTotal       = 6000
+)
+
+// DefaultMaxRetries is the number of times a message is retried after being
+// rate limited or failing with a server error.
+const DefaultMaxRetries = 5
+
+// Embed is a rich content block in a discord message.
+type Embed struct {
+	Title       string `json:"title,omitempty"`
+	URL         string `json:"url,omitempty"`
+	Description string `json:"description,omitempty"`
+	Color       int    `json:"color,omitempty"`
+}
+
+// Message is the payload posted to a webhook.
+type Message struct {
+	Content string  `json:"content,omitempty"`
+	Embeds  []Embed `json:"embeds,omitempty"`
+}
+
+// Sender performs the HTTP requests of a Webhook. *http.Client satisfies it,
+// and tests may substitute a client pointed at a local server.
+type Sender interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// Webhook posts messages to a discord webhook URL.
+type Webhook struct {
+	URL        string
+	Sender     Sender
+	MaxRetries int
+
+	// sleep waits between retries, returning early if ctx is cancelled.
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+// NewWebhook creates a Webhook posting to the passed URL using sender, or
+// http.DefaultClient if sender is nil.
+func NewWebhook(webhookURL string, sender Sender) (*Webhook, error) {
+	u, err := url.Parse(webhookURL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return nil, fmt.Errorf("discord webhook URL %q malformed", webhookURL)
+	}
+
+	// wait for the message to be created so failures are reported to us
+	query := u.Query()
+	query.Set("wait", "true")
+	u.RawQuery = query.Encode()
+
+	if sender == nil {
+		sender = http.DefaultClient
+	}
+	return &Webhook{
+		URL:        u.String(),
+		Sender:     sender,
+		MaxRetries: DefaultMaxRetries,
+		sleep:      sleepContext,
+	}, nil
+}
+
+// Send posts a message, waiting and retrying when discord rate limits the
+// webhook or responds with a server error.
+func (w *Webhook) Send(ctx context.Context, msg *Message) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := w.Sender.Do(req)
+		if err != nil {
+			return fmt.Errorf("failed to post discord message: %w", err)
+		}
+		respBody, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		var wait time.Duration
+		switch {
+		case resp.StatusCode == http.StatusTooManyRequests:
+			wait = retryAfter(resp.Header, respBody)
+			zap.S().Named("discord").Debugf("rate limited by discord, retrying in %s", wait)
+		case resp.StatusCode >= 500:
+			wait = time.Duration(1<<attempt) * time.Second
+			zap.S().Named("discord").Debugf("discord responded with %s, retrying in %s", resp.Status, wait)
+		case resp.StatusCode >= 300:
+			return fmt.Errorf("discord rejected message: %s: %s", resp.Status, bytes.TrimSpace(respBody))
+		default:
+			// out of requests for this bucket, wait for it to reset before the next message
+			if resp.Header.Get("X-RateLimit-Remaining") == "0" {
+				if reset := parseSeconds(resp.Header.Get("X-RateLimit-Reset-After")); reset > 0 {
+					zap.S().Named("discord").Debugf("discord rate limit bucket exhausted, waiting %s", reset)
+					return w.wait(ctx, reset)
+				}
+			}
+			return nil
+		}
+
+		if attempt >= w.MaxRetries {
+			return fmt.Errorf("failed to post discord message after %d attempts: %s", attempt+1, resp.Status)
+		}
+		if err := w.wait(ctx, wait); err != nil {
+			return err
+		}
+	}
+}
+
+// retryAfter reads how long to wait from a 429 response, preferring the
+// precise value in the body over the header.
+func retryAfter(header http.Header, body []byte) time.Duration {
+	var rateLimit struct {
+		RetryAfter float64 `json:"retry_after"`
+	}
+	if err := json.Unmarshal(body, &rateLimit); err == nil && rateLimit.RetryAfter > 0 {
+		return time.Duration(rateLimit.RetryAfter * float64(time.Second))
+	}
+	if wait := parseSeconds(header.Get("Retry-After")); wait > 0 {
+		return wait
+	}
+	return time.Second
+}
+
+func parseSeconds(value string) time.Duration {
+	seconds, err := strconv.ParseFloat(value, 64)
+	if err != nil || seconds <= 0 {
+		return 0
+	}
+	return time.Duration(seconds * float64(time.Second))
+}
+
+func (w *Webhook) wait(ctx context.Context, d time.Duration) error {
+	if w.sleep == nil {
+		return sleepContext(ctx, d)
+	}
+	return w.sleep(ctx, d)
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// PackEmbeds groups embeds into as few messages as discord allows, keeping
+// their order.
+func PackEmbeds(embeds []Embed) []*Message {
+	var messages []*Message
+	current := &Message{}
+	var total int
+
+	for _, embed := range embeds {
+		size := len([]rune(embed.Title)) + len([]rune(embed.Description))
+		if len(current.Embeds) == MaxEmbedsPerMessage || (len(current.Embeds) != 0 && total+size > MaxEmbedTotal) {
+			messages = append(messages, current)
+			current = &Message{}
+			total = 0
+		}
+		current.Embeds = append(current.Embeds, embed)
+		total += size
+	}
+	if len(current.Embeds) != 0 {
+		messages = append(messages, current)
+	}
+	return messages
+}
@@ -0,0 +1,154 @@
+package discord
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestWebhook creates a webhook posting to a local server answering with
+// the passed handlers in turn, recording the waits between attempts.
+func newTestWebhook(t *testing.T, handlers ...http.HandlerFunc) (*Webhook, *[]time.Duration, *int) {
+	t.Helper()
+	var calls int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls >= len(handlers) {
+			t.Errorf("unexpected request %d", calls+1)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if r.URL.Query().Get("wait") != "true" {
+			t.Errorf("request without wait=true: %s", r.URL)
+		}
+		handlers[calls](w, r)
+		calls++
+	}))
+	t.Cleanup(server.Close)
+
+	webhook, err := NewWebhook(server.URL+"/api/webhooks/1/token", server.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var waits []time.Duration
+	webhook.sleep = func(_ context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		return nil
+	}
+	return webhook, &waits, &calls
+}
+
+func respond(status int, header map[string]string, body string) http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		for k, v := range header {
+			w.Header().Set(k, v)
+		}
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(body))
+	}
+}
+
+func TestSendRetriesAfterRateLimit(t *testing.T) {
+	webhook, waits, calls := newTestWebhook(t,
+		respond(http.StatusTooManyRequests, map[string]string{"Retry-After": "3"}, ""),
+		respond(http.StatusOK, nil, "{}"),
+	)
+
+	if err := webhook.Send(context.Background(), &Message{Content: "hello"}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if *calls != 2 {
+		t.Errorf("got %d requests, want 2", *calls)
+	}
+	if !slices.Equal(*waits, []time.Duration{3 * time.Second}) {
+		t.Errorf("got waits %v, want [3s]", *waits)
+	}
+}
+
+func TestSendRetriesServerErrors(t *testing.T) {
+	webhook, waits, calls := newTestWebhook(t,
+		respond(http.StatusBadGateway, nil, ""),
+		respond(http.StatusServiceUnavailable, nil, ""),
+		respond(http.StatusOK, nil, "{}"),
+	)
+
+	if err := webhook.Send(context.Background(), &Message{Content: "hello"}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if *calls != 3 {
+		t.Errorf("got %d requests, want 3", *calls)
+	}
+	want := []time.Duration{time.Second, 2 * time.Second}
+	if !slices.Equal(*waits, want) {
+		t.Errorf("got waits %v, want %v", *waits, want)
+	}
+}
+
+func TestSendGivesUpAfterMaxRetries(t *testing.T) {
+	webhook, _, calls := newTestWebhook(t,
+		respond(http.StatusInternalServerError, nil, ""),
+		respond(http.StatusInternalServerError, nil, ""),
+	)
+	webhook.MaxRetries = 1
+
+	if err := webhook.Send(context.Background(), &Message{Content: "hello"}); err == nil {
+		t.Fatal("Send succeeded, want error")
+	}
+	if *calls != 2 {
+		t.Errorf("got %d requests, want 2", *calls)
+	}
+}
+
+func TestSendStopsWhenCancelled(t *testing.T) {
+	webhook, _, _ := newTestWebhook(t,
+		respond(http.StatusTooManyRequests, map[string]string{"Retry-After": "60"}, ""),
+	)
+	webhook.sleep = sleepContext
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := webhook.Send(ctx, &Message{Content: "hello"}); err == nil {
+		t.Fatal("Send succeeded, want error")
+	}
+}
+
+func TestPackEmbeds(t *testing.T) {
+	embed := func(size int) Embed {
+		return Embed{Title: "repo", Description: strings.Repeat("x", size-len("repo"))}
+	}
+	repeat := func(n, size int) []Embed {
+		var embeds []Embed
+		for range n {
+			embeds = append(embeds, embed(size))
+		}
+		return embeds
+	}
+
+	tests := []struct {
+		name   string
+		embeds []Embed
+		want   []int
+	}{
+		{name: "none", embeds: nil, want: nil},
+		{name: "embed count limit", embeds: repeat(MaxEmbedsPerMessage, 100), want: []int{10}},
+		{name: "over embed count limit", embeds: repeat(MaxEmbedsPerMessage+1, 100), want: []int{10, 1}},
+		{name: "total size limit", embeds: repeat(2, MaxEmbedTotal/2), want: []int{2}},
+		{name: "over total size limit", embeds: repeat(3, MaxEmbedTotal/2), want: []int{2, 1}},
+		{name: "oversized embed alone", embeds: repeat(2, MaxEmbedTotal), want: []int{1, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			messages := PackEmbeds(tt.embeds)
+			var got []int
+			for _, message := range messages {
+				got = append(got, len(message.Embeds))
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got messages of %v embeds, want %v", got, tt.want)
+			}
+		})
+	}
+}
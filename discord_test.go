@@ -0,0 +1,94 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTruncateRunes(t *testing.T) {
+	tests := []struct {
+		text string
+		n    int
+		want string
+	}{
+		{"hello", 5, "hello"},
+		{"hello", 4, "hel…"},
+		{"héllo wörld", 3, "hé…"},
+		{"hello", 1, "…"},
+		{"hello", 0, ""},
+		{"hello", -3, ""},
+		{"", 0, ""},
+	}
+	for _, tt := range tests {
+		if got := truncateRunes(tt.text, tt.n); got != tt.want {
+			t.Errorf("truncateRunes(%q, %d) = %q, want %q", tt.text, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestChunkDiscordSections(t *testing.T) {
+	// "**repo**:\n" is 10 characters, each line adds its length plus a newline
+	section := func(repo string, lines ...string) discordSection {
+		return discordSection{Repo: repo, Lines: lines}
+	}
+	line := func(n int) string {
+		return strings.Repeat("x", n)
+	}
+
+	tests := []struct {
+		name     string
+		sections []discordSection
+		limit    int
+		want     []string
+	}{
+		{
+			name:     "section at the limit",
+			sections: []discordSection{section("repo", line(20))},
+			limit:    30,
+			want:     []string{"**repo**:\n" + line(20)},
+		},
+		{
+			name:     "sections at the limit together",
+			sections: []discordSection{section("repo", line(5)), section("repo", line(5))},
+			limit:    32,
+			want:     []string{"**repo**:\n" + line(5) + "\n\n**repo**:\n" + line(5)},
+		},
+		{
+			name:     "second section one over the limit",
+			sections: []discordSection{section("repo", line(5)), section("repo", line(6))},
+			limit:    32,
+			want:     []string{"**repo**:\n" + line(5), "**repo**:\n" + line(6)},
+		},
+		{
+			name:     "section one over the limit is split by line",
+			sections: []discordSection{section("repo", line(10), line(10))},
+			limit:    30,
+			want:     []string{"**repo**:\n" + line(10), "**repo** (cont.):\n" + line(10)},
+		},
+		{
+			name:     "line longer than a message is truncated",
+			sections: []discordSection{section("repo", line(40))},
+			limit:    30,
+			want:     []string{"**repo**:\n" + line(11) + "…"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := chunkDiscordSections(tt.sections, tt.limit)
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("got messages %q, want %q", got, tt.want)
+			}
+			for _, message := range got {
+				if n := utf8.RuneCountInString(message); n > tt.limit {
+					t.Errorf("message of %d characters exceeds the limit of %d: %q", n, tt.limit, message)
+				}
+			}
+		})
+	}
+}
+
+func TestChunkDiscordSectionsHeadingOverLimit(t *testing.T) {
+	// the continuation heading alone exceeds the limit, which must not panic
+	chunkDiscordSections([]discordSection{{Repo: strings.Repeat("r", 20), Lines: []string{"line"}}}, 10)
+}
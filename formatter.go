@@ -1,74 +1,282 @@
 package main
 
 import (
-	"errors"
+	"context"
 	"fmt"
+	"regexp"
 	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/google/go-github/v67/github"
 	"go.uber.org/zap"
+
+	nhgithub "github.com/serenibyss/nhprtracker/github"
+	"github.com/serenibyss/nhprtracker/internal"
+)
+
+// Report is the data gathered by a command that is handed to a formatter.
+type Report struct {
+	Command string
+	Org     string
+	Branch  string
+	Date    time.Time
+
+	// EndDate is the end of the window PRs were gathered from, or zero if it
+	// reaches up to now.
+	EndDate time.Time
+
+	// SinceTag and UntilTag are the tags bounding the window of repositories
+	// having them, if any.
+	SinceTag string
+	UntilTag string
+
+	// PRs maps "org/repo" to the pull requests found for that repository.
+	PRs map[string][]*github.PullRequest
+
+	// Matrix holds the state of each PR on each release branch. It is only
+	// set for commands comparing against release branches.
+	Matrix *nhgithub.BranchMatrix
+
+	// Reverts links reverted PRs with their reverts, when they are flagged
+	// rather than dropped from the report.
+	Reverts *nhgithub.Reverts
+
+	// Excluded holds the number of PRs each exclusion rule left out of the
+	// report.
+	Excluded []internal.ExclusionCount
+}
+
+// Reasons a PR can be judged missing from the release branch.
+const (
+	reasonNoReleaseBranch  = "no-release-branch"
+	reasonNoMatchingCommit = "no-matching-commit"
 )
 
-// SanitizeTimestamp converts a DateOnly timestamp to a time.Time.
-func SanitizeTimestamp(date string) (time.Time, error) {
+// MissingReason explains why the PR was reported as missing from the release
+// branch, or returns an empty string when the report does not compare against
+// exactly one release branch.
+func (r *Report) MissingReason(pr *github.PullRequest) string {
+	if r.Matrix == nil || len(r.Matrix.Branches) != 1 {
+		return ""
+	}
+	switch r.Matrix.State(pr, r.Matrix.Branches[0]) {
+	case nhgithub.StateNoReleaseBranch:
+		return reasonNoReleaseBranch
+	case nhgithub.StateMissing:
+		return reasonNoMatchingCommit
+	default:
+		return ""
+	}
+}
+
+// BranchNote summarizes which release branches contain the PR and the
+// strategy that found it there, like "release/2.7.x ✗, release/2.8.x ✓
+// (cherry-pick)", or returns an empty string when the report does not compare
+// against several release branches.
+func (r *Report) BranchNote(pr *github.PullRequest) string {
+	if r.Matrix == nil || len(r.Matrix.Branches) < 2 {
+		return ""
+	}
+	var parts []string
+	for _, branch := range r.Matrix.Branches {
+		var mark string
+		switch r.Matrix.State(pr, branch) {
+		case nhgithub.StateContained:
+			mark = "✓"
+			if strategy := r.Matrix.MatchedBy(pr, branch); strategy != "" {
+				mark += " (" + string(strategy) + ")"
+			}
+		case nhgithub.StateMissing, nhgithub.StateNoReleaseBranch:
+			mark = "✗"
+		default:
+			mark = "-"
+		}
+		parts = append(parts, branch+" "+mark)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Notes returns the notes shown next to the PR, like its revert and release
+// branch notes.
+func (r *Report) Notes(pr *github.PullRequest) []string {
+	var notes []string
+	for _, note := range []string{r.RevertNote(pr), r.BranchNote(pr)} {
+		if note != "" {
+			notes = append(notes, note)
+		}
+	}
+	return notes
+}
+
+// RevertNote describes how the PR relates to a revert, or returns an empty
+// string if it was neither reverted nor reverts another PR.
+func (r *Report) RevertNote(pr *github.PullRequest) string {
+	if revert := r.Reverts.RevertedBy(pr); revert != nil {
+		if revert.PR != nil {
+			return fmt.Sprintf("merged then reverted by #%d", revert.PR.GetNumber())
+		}
+		return fmt.Sprintf("merged then reverted by commit %.7s", revert.SHA)
+	}
+	if original := r.Reverts.RevertOf(pr); original != nil {
+		return fmt.Sprintf("reverts #%d", original.GetNumber())
+	}
+	return ""
+}
+
+// relativeTimestampPattern matches durations before now, like "14d".
+var relativeTimestampPattern = regexp.MustCompile(`^(\d+)([hdw])$`)
+
+// relativeTimestampUnits are the units of relative timestamps.
+var relativeTimestampUnits = map[string]time.Duration{
+	"h": time.Hour,
+	"d": 24 * time.Hour,
+	"w": 7 * 24 * time.Hour,
+}
+
+// SanitizeTimestamp converts a DateOnly timestamp, or a duration before now
+// like "14d", passed to the named flag to a time.Time.
+func SanitizeTimestamp(flag, date string) (time.Time, error) {
+	if match := relativeTimestampPattern.FindStringSubmatch(date); match != nil {
+		n, err := strconv.Atoi(match[1])
+		if err != nil {
+			return time.Time{}, fmt.Errorf("'%s' flag malformed: %w", flag, err)
+		}
+		return time.Now().UTC().Add(-time.Duration(n) * relativeTimestampUnits[match[2]]), nil
+	}
+
 	timestamp, err := time.Parse(time.DateOnly, date)
 	if err != nil {
-		return timestamp, fmt.Errorf("'start-date' flag malformed, must be in YYYY-MM-DD format: %w", err)
+		return timestamp, fmt.Errorf("'%s' flag malformed, must be in YYYY-MM-DD format or a duration like 14d: %w", flag, err)
 	}
 	return timestamp, nil
 }
 
-// PrintPRList outputs the passed PR data to the console.
-func PrintPRList(prMap map[string][]*github.PullRequest, format string) error {
-	switch format {
-	case "terminal":
-		return printTerminalPRList(prMap)
-	case "discord":
-		return printDiscordPRList(prMap)
-	default:
-		return errors.New("unsupported format option %s, allowed: 'terminal', 'discord'")
+// SanitizeEndTimestamp converts a timestamp like SanitizeTimestamp, but moves a
+// DateOnly timestamp to the end of that day, so PRs merged on the end date
+// are included.
+func SanitizeEndTimestamp(flag, date string) (time.Time, error) {
+	timestamp, err := SanitizeTimestamp(flag, date)
+	if err != nil || relativeTimestampPattern.MatchString(date) {
+		return timestamp, err
 	}
+	return timestamp.AddDate(0, 0, 1).Add(-time.Nanosecond), nil
 }
 
-func printDiscordPRList(prMap map[string][]*github.PullRequest) error {
-	zap.S().Named("output").Info("Copy paste the below into discord")
-	fmt.Println()
+// Formatter renders the results of a command.
+type Formatter interface {
+	Format(report *Report) error
+}
 
-	var keys []string
-	for k := range prMap {
-		keys = append(keys, k)
+// FormatterFunc adapts an ordinary function to the Formatter interface.
+type FormatterFunc func(report *Report) error
+
+// Format calls f(report).
+func (f FormatterFunc) Format(report *Report) error {
+	return f(report)
+}
+
+// FormatterOptions holds user supplied settings that formatters may need
+// when they are constructed.
+type FormatterOptions struct {
+	// Ctx cancels formatters doing network requests, like posting to a
+	// discord webhook.
+	Ctx context.Context
+
+	TemplateFile string
+
+	// DiscordChunkDir, when set, makes the discord formatter write each
+	// message to a separate file in this directory instead of stdout.
+	DiscordChunkDir string
+
+	// DiscordWebhook, when set, makes the discord formatter post its
+	// messages to this webhook URL.
+	DiscordWebhook string
+}
+
+// FormatterFactory constructs a Formatter from the passed options.
+type FormatterFactory func(opts *FormatterOptions) (Formatter, error)
+
+var formatters = map[string]FormatterFactory{}
+
+// RegisterFormatter makes a formatter available under the passed name for the
+// 'formatting' flag. It panics if the name is registered twice.
+func RegisterFormatter(name string, factory FormatterFactory) {
+	if _, ok := formatters[name]; ok {
+		panic(fmt.Sprintf("formatter %s registered twice", name))
 	}
-	slices.Sort(keys)
+	formatters[name] = factory
+}
 
-	for _, k := range keys {
-		fmt.Printf("**%s**:\n", k)
-		prs := prMap[k]
-		for _, pr := range prs {
-			fmt.Printf("- #%d: [%s](<%s>)\n", pr.GetNumber(), pr.GetTitle(), pr.GetHTMLURL())
-		}
-		fmt.Println()
+// FormatterNames returns the names of all registered formatters in
+// alphabetical order.
+func FormatterNames() []string {
+	var names []string
+	for name := range formatters {
+		names = append(names, name)
 	}
-	return nil
+	slices.Sort(names)
+	return names
 }
 
-func printTerminalPRList(prMap map[string][]*github.PullRequest) error {
-	zap.S().Named("output").Info("Pull Requests:")
-	zap.S().Named("output").Info()
+// NewFormatter constructs the formatter registered under the passed name.
+func NewFormatter(name string, opts *FormatterOptions) (Formatter, error) {
+	factory, ok := formatters[name]
+	if !ok {
+		return nil, fmt.Errorf("unsupported format option %s, allowed: '%s'", name, strings.Join(FormatterNames(), "', '"))
+	}
+	return factory(opts)
+}
+
+func init() {
+	RegisterFormatter("terminal", func(*FormatterOptions) (Formatter, error) {
+		return FormatterFunc(func(report *Report) error {
+			return printTerminalPRList(report)
+		}), nil
+	})
+	RegisterFormatter("discord", newDiscordFormatter)
+	RegisterFormatter("json", func(*FormatterOptions) (Formatter, error) {
+		return FormatterFunc(printJSONPRList), nil
+	})
+	RegisterFormatter("template", newTemplateFormatter)
+}
 
+// Repos returns the repository names of the report in alphabetical order.
+func (r *Report) Repos() []string {
+	return sortedRepoNames(r.PRs)
+}
+
+// sortedRepoNames returns the keys of the passed PR map in alphabetical order.
+func sortedRepoNames(prMap map[string][]*github.PullRequest) []string {
 	var keys []string
 	for k := range prMap {
 		keys = append(keys, k)
 	}
 	slices.Sort(keys)
+	return keys
+}
+
+func printTerminalPRList(report *Report) error {
+	prMap := report.PRs
+	zap.S().Named("output").Info("Pull Requests:")
+	zap.S().Named("output").Info()
 
-	for _, k := range keys {
+	for _, k := range sortedRepoNames(prMap) {
 		zap.S().Named("output").Infof("%s:", k)
 		prs := prMap[k]
 		for _, pr := range prs {
+			if notes := report.Notes(pr); len(notes) != 0 {
+				zap.S().Named("output").Infof("#%d: %s (%s) [%s]", pr.GetNumber(), pr.GetTitle(), pr.GetHTMLURL(), strings.Join(notes, "; "))
+				continue
+			}
 			zap.S().Named("output").Infof("#%d: %s (%s)", pr.GetNumber(), pr.GetTitle(), pr.GetHTMLURL())
 		}
 		zap.S().Named("output").Info()
 	}
+
+	for _, excluded := range report.Excluded {
+		zap.S().Named("output").Infof("Excluded %d PRs by %s", excluded.Count, excluded.Rule)
+	}
 	return nil
 }
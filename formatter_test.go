@@ -0,0 +1,51 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/serenibyss/nhprtracker/auth"
+)
+
+func TestSanitizeEndTimestampIncludesEndDate(t *testing.T) {
+	end, err := SanitizeEndTimestamp("end-date", "2025-01-15")
+	if err != nil {
+		t.Fatal(err)
+	}
+	start, err := SanitizeTimestamp("start-date", "2025-01-15")
+	if err != nil {
+		t.Fatal(err)
+	}
+	window := auth.Window{Start: start, End: end}
+
+	tests := []struct {
+		merged string
+		want   bool
+	}{
+		{"2025-01-14T23:59:59Z", false},
+		{"2025-01-15T00:00:00Z", true},
+		{"2025-01-15T12:30:00Z", true},
+		{"2025-01-15T23:59:59Z", true},
+		{"2025-01-16T00:00:00Z", false},
+	}
+	for _, tt := range tests {
+		merged, err := time.Parse(time.RFC3339, tt.merged)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := window.Contains(merged); got != tt.want {
+			t.Errorf("window %s to %s contains %s = %v, want %v", start, end, tt.merged, got, tt.want)
+		}
+	}
+}
+
+func TestSanitizeEndTimestampRelative(t *testing.T) {
+	before := time.Now().UTC().Add(-14 * 24 * time.Hour)
+	end, err := SanitizeEndTimestamp("end-date", "14d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if end.Before(before) || end.After(before.Add(time.Minute)) {
+		t.Errorf("got end %s, want about %s", end, before)
+	}
+}
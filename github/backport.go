@@ -0,0 +1,228 @@
+package github
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-github/v67/github"
+	"go.uber.org/zap"
+
+	"github.com/serenibyss/nhprtracker/auth"
+)
+
+// errBackportConflict is returned when a PR does not apply cleanly to the
+// release branch.
+var errBackportConflict = errors.New("changes conflict with the release branch")
+
+// backportTitle returns the title of the backport of a PR to the release
+// branch, like "[2.7.x] Fix thing (#123)".
+func backportTitle(client *auth.GithubClient, pr *github.PullRequest) string {
+	return fmt.Sprintf("[%s] %s (#%d)", path.Base(client.Branch), pr.GetTitle(), pr.GetNumber())
+}
+
+// backportBranch returns the name of the branch holding the backport of a PR.
+func backportBranch(client *auth.GithubClient, pr *github.PullRequest) string {
+	return fmt.Sprintf("backport/%s/%d", path.Base(client.Branch), pr.GetNumber())
+}
+
+// ParsePRReference parses a 'REPO#NUMBER' reference to a PR, where REPO may
+// be prefixed by an organization. The repo name is returned with the client's
+// organization, as used for keys in PR maps.
+func ParsePRReference(client *auth.GithubClient, ref string) (string, int, error) {
+	repoName, numberText, ok := strings.Cut(ref, "#")
+	number, err := strconv.Atoi(numberText)
+	if !ok || repoName == "" || err != nil || number <= 0 {
+		return "", 0, fmt.Errorf("PR reference %q malformed, must be in REPO#NUMBER format", ref)
+	}
+
+	if org, name, ok := strings.Cut(repoName, "/"); ok {
+		if !strings.EqualFold(org, client.Org) {
+			return "", 0, fmt.Errorf("PR reference %q is not in organization %s", ref, client.Org)
+		}
+		repoName = name
+	}
+	return client.Org + "/" + repoName, number, nil
+}
+
+// GatherPRsByReference fetches the PRs referenced in 'REPO#NUMBER' format,
+// keyed by repository like the PR maps of GatherMergedPRs.
+func GatherPRsByReference(client *auth.GithubClient, refs []string) (map[string][]*github.PullRequest, error) {
+	prMap := map[string][]*github.PullRequest{}
+	var hadError bool
+
+	for _, ref := range refs {
+		repoName, number, err := ParsePRReference(client, ref)
+		if err != nil {
+			return nil, err
+		}
+
+		pr, _, err := client.PullRequests.Get(client.Ctx, client.Org, strings.TrimPrefix(repoName, client.Org+"/"), number)
+		if err != nil {
+			zap.S().Named("github").Errorf("failed to get PR %s: %v", ref, err)
+			hadError = true
+			continue
+		}
+		if !pr.GetMerged() {
+			zap.S().Named("github").Errorf("PR %s has not been merged", ref)
+			hadError = true
+			continue
+		}
+		prMap[repoName] = append(prMap[repoName], pr)
+	}
+
+	if hadError {
+		return prMap, errors.New("some PRs could not be found, see logs above")
+	}
+	return prMap, nil
+}
+
+// PlanBackports plans opening a backport PR for each PR against each release
+// branch it is selected for, keyed by release branch then by repository.
+// Each backport cherry-picks the merge commit of the PR onto a new branch off
+// the release branch, entirely through the Git Data API, so nothing is cloned.
+// PRs that do not apply cleanly fail and must be backported manually.
+func PlanBackports(client *auth.GithubClient, branchPRs map[string]map[string][]*github.PullRequest) *Plan {
+	plan := &Plan{}
+	for branch, prMap := range branchPRs {
+		branchClient := client.WithBranch(branch)
+		for repoName, prs := range prMap {
+			for _, pr := range prs {
+				plan.add(backportChange(branchClient, strings.TrimPrefix(repoName, client.Org+"/"), pr))
+			}
+		}
+	}
+	plan.sort()
+	return plan
+}
+
+// backportChange plans backporting the PR to the release branch of the
+// client.
+func backportChange(branchClient *auth.GithubClient, repoName string, pr *github.PullRequest) *Change {
+	branch := branchClient.Branch
+	return &Change{
+		Repo:   repoName,
+		Target: backportBranch(branchClient, pr),
+		Action: "backport",
+		Fields: []FieldChange{
+			{Field: "base", Current: unsetField, Desired: branch},
+			{Field: "title", Current: unsetField, Desired: backportTitle(branchClient, pr)},
+		},
+		apply: func(client *auth.GithubClient) error {
+			_, err := backportPR(client.WithBranch(branch), repoName, pr)
+			if errors.Is(err, errBackportConflict) {
+				return fmt.Errorf("%w, backport it manually", err)
+			}
+			return err
+		},
+	}
+}
+
+func backportPR(client *auth.GithubClient, repoName string, pr *github.PullRequest) (*github.PullRequest, error) {
+	mergeSHA := pr.GetMergeCommitSHA()
+	if mergeSHA == "" {
+		return nil, errors.New("PR has no merge commit")
+	}
+
+	mergeCommit, _, err := client.Git.GetCommit(client.Ctx, client.Org, repoName, mergeSHA)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get merge commit: %w", err)
+	}
+	if len(mergeCommit.Parents) == 0 {
+		return nil, errors.New("merge commit has no parent")
+	}
+
+	releaseRef, _, err := client.Git.GetRef(client.Ctx, client.Org, repoName, "heads/"+client.Branch)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get release branch: %w", err)
+	}
+	releaseCommit, _, err := client.Git.GetCommit(client.Ctx, client.Org, repoName, releaseRef.GetObject().GetSHA())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get release branch commit: %w", err)
+	}
+
+	// Start the branch from a commit with the release branch contents, but
+	// the PR's parent as history. Merging the PR into it then applies only
+	// the PR's own changes to the release branch contents.
+	base, _, err := client.Git.CreateCommit(client.Ctx, client.Org, repoName, &github.Commit{
+		Message: github.String(fmt.Sprintf("Temporary commit for backport of #%d", pr.GetNumber())),
+		Tree:    releaseCommit.Tree,
+		Parents: []*github.Commit{{SHA: mergeCommit.Parents[0].SHA}},
+	}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary commit: %w", err)
+	}
+
+	branch := backportBranch(client, pr)
+	_, resp, err := client.Git.CreateRef(client.Ctx, client.Org, repoName, &github.Reference{
+		Ref:    github.String("refs/heads/" + branch),
+		Object: &github.GitObject{SHA: base.SHA},
+	})
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusUnprocessableEntity {
+			return nil, fmt.Errorf("branch %s already exists", branch)
+		}
+		return nil, fmt.Errorf("failed to create branch %s: %w", branch, err)
+	}
+
+	backport, err := applyBackport(client, repoName, pr, branch, releaseCommit, mergeSHA)
+	if err != nil {
+		if _, delErr := client.Git.DeleteRef(client.Ctx, client.Org, repoName, "heads/"+branch); delErr != nil {
+			zap.S().Named("github").Errorf("failed to clean up branch %s on repo %s: %v", branch, repoName, delErr)
+		}
+		return nil, err
+	}
+	zap.S().Named("github").Infof("opened backport PR #%d for PR #%d on repo %s: %s", backport.GetNumber(), pr.GetNumber(), repoName, backport.GetHTMLURL())
+	return backport, nil
+}
+
+// applyBackport merges the PR into the prepared branch, rewrites the result
+// as a single commit on top of the release branch and opens the backport PR.
+func applyBackport(client *auth.GithubClient, repoName string, pr *github.PullRequest, branch string, releaseCommit *github.Commit, mergeSHA string) (*github.PullRequest, error) {
+	merged, resp, err := client.Repositories.Merge(client.Ctx, client.Org, repoName, &github.RepositoryMergeRequest{
+		Base:          github.String(branch),
+		Head:          github.String(mergeSHA),
+		CommitMessage: github.String(fmt.Sprintf("Temporary merge for backport of #%d", pr.GetNumber())),
+	})
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusConflict {
+			return nil, errBackportConflict
+		}
+		return nil, fmt.Errorf("failed to apply changes: %w", err)
+	}
+	if merged == nil {
+		return nil, errors.New("changes are already on the release branch")
+	}
+
+	message := fmt.Sprintf("%s (#%d)\n\n(cherry picked from commit %s)", pr.GetTitle(), pr.GetNumber(), mergeSHA)
+	commit, _, err := client.Git.CreateCommit(client.Ctx, client.Org, repoName, &github.Commit{
+		Message: github.String(message),
+		Tree:    merged.GetCommit().GetTree(),
+		Parents: []*github.Commit{{SHA: releaseCommit.SHA}},
+	}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create backport commit: %w", err)
+	}
+
+	_, _, err = client.Git.UpdateRef(client.Ctx, client.Org, repoName, &github.Reference{
+		Ref:    github.String("refs/heads/" + branch),
+		Object: &github.GitObject{SHA: commit.SHA},
+	}, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update branch %s: %w", branch, err)
+	}
+
+	backport, _, err := client.PullRequests.Create(client.Ctx, client.Org, repoName, &github.NewPullRequest{
+		Title: github.String(backportTitle(client, pr)),
+		Head:  github.String(branch),
+		Base:  github.String(client.Branch),
+		Body:  github.String(fmt.Sprintf("Backport of #%d (%s) to `%s`.", pr.GetNumber(), pr.GetHTMLURL(), client.Branch)),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open backport PR: %w", err)
+	}
+	return backport, nil
+}
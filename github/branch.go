@@ -3,9 +3,11 @@ package github
 import (
 	"errors"
 	"fmt"
+	"slices"
+	"strings"
+
 	"github.com/google/go-github/v67/github"
 	"go.uber.org/zap"
-	"strings"
 
 	"github.com/serenibyss/nhprtracker/auth"
 )
@@ -36,61 +38,204 @@ func checkForReleaseBranch(client *auth.GithubClient, repo *github.Repository) (
 	return false, nil
 }
 
-func FilterMatchingCommitsOnBranch(client *auth.GithubClient, prMap map[string][]*github.PullRequest, releaseRepos map[string]*github.Repository) (map[string][]*github.PullRequest, error) {
-	newPrMap := map[string][]*github.PullRequest{}
+// isBranchPattern checks if a release branch contains glob characters, and
+// so has to be matched against the branches of each repository.
+func isBranchPattern(branch string) bool {
+	return strings.ContainsAny(branch, "*?[")
+}
+
+// matchesReleaseBranch checks the branch name against the release branches of
+// the client, which may be glob patterns.
+func matchesReleaseBranch(client *auth.GithubClient, name string) bool {
+	return matchesAny(client.Branches, name)
+}
+
+// gatherMatchingBranches lists the branches of the repository matching the
+// release branches of the client.
+func gatherMatchingBranches(client *auth.GithubClient, repoName string) ([]string, error) {
+	var names []string
+	opts := &github.BranchListOptions{}
+
+	for {
+		branches, resp, err := client.Repositories.ListBranches(client.Ctx, client.Org, repoName, opts)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, branch := range branches {
+			if matchesReleaseBranch(client, branch.GetName()) {
+				zap.S().Named("github").Debugf("found repo with branch %s: %s", branch.GetName(), repoName)
+				names = append(names, branch.GetName())
+			}
+		}
+
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+	return names, nil
+}
+
+// ResolveReleaseBranches expands the release branches of the client into the
+// branch names found on the passed repositories, in alphabetical order.
+// Release branches without glob characters are kept as they are, so no
+// requests are made unless a pattern was passed.
+func ResolveReleaseBranches(client *auth.GithubClient, repos []*github.Repository) ([]string, error) {
+	var branches []string
+	var hasPattern bool
+	for _, branch := range client.Branches {
+		if isBranchPattern(branch) {
+			hasPattern = true
+		} else if !slices.Contains(branches, branch) {
+			branches = append(branches, branch)
+		}
+	}
+	if !hasPattern {
+		return branches, nil
+	}
+
+	found := make([][]string, len(repos))
+	errs := forEach(client, len(repos), func(i int) error {
+		var err error
+		found[i], err = gatherMatchingBranches(client, repos[i].GetName())
+		return err
+	})
+	if err := client.Ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	var hadError bool
-	for repoName, prs := range prMap {
-		releaseRepo := releaseRepos[repoName]
+	for i, repo := range repos {
+		if errs[i] != nil {
+			zap.S().Named("github").Errorf("failed to list branches for repo %s/%s: %v", client.Org, repo.GetName(), errs[i])
+			hadError = true
+		}
+		for _, branch := range found[i] {
+			if !slices.Contains(branches, branch) {
+				branches = append(branches, branch)
+			}
+		}
+	}
+	slices.Sort(branches)
+
+	if len(branches) == 0 {
+		return nil, fmt.Errorf("no branches match release branches %v", client.Branches)
+	}
+	zap.S().Named("github").Infof("Resolved release branches: %v", branches)
+	if hadError {
+		return branches, errors.New("some repo branches could not be listed, see logs above")
+	}
+	return branches, nil
+}
+
+// FilterMatchingCommitsOnBranch returns the PRs that the passed strategies
+// could not find on the release branch of their repository, along with the
+// strategy that found each of the others.
+func FilterMatchingCommitsOnBranch(client *auth.GithubClient, prMap map[string][]*github.PullRequest, releaseRepos map[string]*github.Repository, strategies []MatchStrategy) (map[string][]*github.PullRequest, map[*github.PullRequest]MatchStrategy, error) {
+	newPrMap := map[string][]*github.PullRequest{}
+	matched := map[*github.PullRequest]MatchStrategy{}
+
+	var repoNames []string
+	for repoName := range prMap {
+		repoNames = append(repoNames, repoName)
+	}
+	slices.Sort(repoNames)
+
+	// Gather all commits on the release branch after a specified date
+	repos := make([]*github.Repository, len(repoNames))
+	for i, repoName := range repoNames {
+		repos[i] = releaseRepos[repoName]
+	}
+	commits, errs := gatherReleaseCommits(client, repos)
+	if err := client.Ctx.Err(); err != nil {
+		return newPrMap, matched, err
+	}
 
+	// Match the PRs of each repository against its release branch
+	missing := make([][]*github.PullRequest, len(repoNames))
+	matches := make([]map[*github.PullRequest]MatchStrategy, len(repoNames))
+	matchErrs := forEach(client, len(repoNames), func(i int) error {
+		releaseRepo := releaseRepos[repoNames[i]]
+		if releaseRepo == nil || errs[i] != nil {
+			return nil
+		}
+		var err error
+		missing[i], matches[i], err = filterMatchingPRs(client, releaseRepo, repoNames[i], prMap[repoNames[i]], newReleaseBranch(commits[i]), strategies)
+		return err
+	})
+	if err := client.Ctx.Err(); err != nil {
+		return newPrMap, matched, err
+	}
+
+	var hadError bool
+	for i, repoName := range repoNames {
 		// Repository does not have a matching branch, so all PRs are valid to check
-		if releaseRepo == nil {
+		if releaseRepos[repoName] == nil {
 			zap.S().Named("github").Debugf("no release branch for repo %s, all PRs valid", repoName)
-			newPrMap[repoName] = prs
+			newPrMap[repoName] = prMap[repoName]
 			continue
 		}
 
-		// Gather all commits on the release branch after a specified date
-		commits, err := gatherCommitsToCheck(client, releaseRepo)
-		if err != nil {
+		if err := errors.Join(errs[i], matchErrs[i]); err != nil {
 			zap.S().Named("github").Errorf("failed to filter PRs: %v", err)
 			hadError = true
 			continue
 		}
 
-		var newPrs []*github.PullRequest
-		for _, pr := range prs {
-			var found bool
-			for _, commit := range commits {
-				message := commit.GetMessage()
-				if strings.Contains(message, fmt.Sprintf("(#%d)", pr.GetNumber())) {
-					zap.S().Named("github").Debugf("found matching release branch commit for PR #%d on repo %s", pr.GetNumber(), repoName)
-					found = true
-					break
-				}
-			}
-			if !found {
-				newPrs = append(newPrs, pr)
-			}
-		}
-		if len(newPrs) != 0 {
-			zap.S().Named("github").Debugf("found %d PRs on repo %s not included in release branch", len(newPrs), repoName)
-			newPrMap[repoName] = newPrs
+		if len(missing[i]) != 0 {
+			zap.S().Named("github").Debugf("found %d PRs on repo %s not included in release branch", len(missing[i]), repoName)
+			newPrMap[repoName] = missing[i]
 		} else {
 			zap.S().Named("github").Debugf("all PRs on repo %s included in release branch, skipping", repoName)
 		}
 	}
 
+	// Report how the PRs already on the release branch were recognised
+	totals := map[MatchStrategy]int{}
+	for _, m := range matches {
+		for pr, strategy := range m {
+			matched[pr] = strategy
+			totals[strategy]++
+		}
+	}
+	for _, strategy := range strategies {
+		zap.S().Named("github").Infof("%d PRs found on %s by %s", totals[strategy], client.Branch, strategy)
+	}
+
 	if hadError {
-		return newPrMap, errors.New("failed to filter PRs for some repos, see log above")
+		return newPrMap, matched, errors.New("failed to filter PRs for some repos, see log above")
 	}
-	return newPrMap, nil
+	return newPrMap, matched, nil
+}
+
+// gatherReleaseCommits gathers the release branch commits of each repository,
+// skipping nil repositories. Results and errors are returned at the index of
+// the repository they belong to.
+func gatherReleaseCommits(client *auth.GithubClient, repos []*github.Repository) ([][]*github.Commit, []error) {
+	if client.API == auth.APIGraphQL {
+		return gatherCommitsGraphQL(client, repos)
+	}
+
+	commits := make([][]*github.Commit, len(repos))
+	errs := forEach(client, len(repos), func(i int) error {
+		if repos[i] == nil {
+			return nil
+		}
+		var err error
+		commits[i], err = gatherCommitsToCheck(client, repos[i])
+		return err
+	})
+	return commits, errs
 }
 
 func gatherCommitsToCheck(client *auth.GithubClient, repo *github.Repository) ([]*github.Commit, error) {
 	var allCommits []*github.Commit
+	window := client.Window(repo.GetName())
 	opts := &github.CommitsListOptions{
 		SHA:   client.Branch,
-		Since: client.Date,
+		Since: window.Start,
+		Until: window.End,
 	}
 
 	for {
@@ -101,7 +246,11 @@ func gatherCommitsToCheck(client *auth.GithubClient, repo *github.Repository) ([
 
 		zap.S().Named("github").Debugf("found %d commits on branch %s for repo %s", len(commits), client.Branch, repo.GetName())
 		for _, commit := range commits {
-			allCommits = append(allCommits, commit.GetCommit())
+			// the SHA is only set on the outer repository commit
+			if c := commit.GetCommit(); c != nil {
+				c.SHA = commit.SHA
+				allCommits = append(allCommits, c)
+			}
 		}
 
 		if resp.NextPage == 0 {
@@ -113,8 +262,16 @@ func gatherCommitsToCheck(client *auth.GithubClient, repo *github.Repository) ([
 	return allCommits, nil
 }
 
-func UpdateBranchRules(client *auth.GithubClient) ([]*github.Repository, error) {
-	var cleansedRepos []*github.Repository
+// repoBranch is a release branch of a repository.
+type repoBranch struct {
+	Repo   *github.Repository
+	Branch string
+}
+
+// gatherProtectionTargets lists the branches matching the release branches of
+// the client on all public, unarchived repositories of the organization.
+func gatherProtectionTargets(client *auth.GithubClient) ([]*repoBranch, error) {
+	var targets []*repoBranch
 	opts := &github.RepositoryListByOrgOptions{
 		Type: "all",
 	}
@@ -137,18 +294,20 @@ func UpdateBranchRules(client *auth.GithubClient) ([]*github.Repository, error)
 				continue
 			}
 
-			hasBranch, err := checkForReleaseBranch(client, repo)
-			if err != nil {
-				zap.S().Named("rules").Errorf("error looking for release branch on repo %s", repo.GetName())
+			if client.Exclusions.ExcludeRepo(repo.GetName()) {
 				continue
 			}
 
-			if !hasBranch {
+			branches, err := gatherMatchingBranches(client, repo.GetName())
+			if err != nil {
+				zap.S().Named("rules").Errorf("error looking for release branch on repo %s", repo.GetName())
 				continue
 			}
 
-			zap.S().Named("rules").Debugf("found repo %s", repo.GetName())
-			cleansedRepos = append(cleansedRepos, repo)
+			for _, branch := range branches {
+				zap.S().Named("rules").Debugf("found repo %s with branch %s", repo.GetName(), branch)
+				targets = append(targets, &repoBranch{Repo: repo, Branch: branch})
+			}
 		}
 
 		if resp.NextPage == 0 {
@@ -156,42 +315,97 @@ func UpdateBranchRules(client *auth.GithubClient) ([]*github.Repository, error)
 		}
 		opts.Page = resp.NextPage
 	}
+	return targets, nil
+}
+
+// getProtection returns the current protection of the branch, or nil if it
+// is not protected.
+func getProtection(client *auth.GithubClient, repoName, branch string) (*github.Protection, error) {
+	protection, _, err := client.Repositories.GetBranchProtection(client.Ctx, client.Org, repoName, branch)
+	if errors.Is(err, github.ErrBranchNotProtected) {
+		return nil, nil
+	}
+	return protection, err
+}
 
-	var addedRepos []*github.Repository
-	for _, repo := range cleansedRepos {
-		repoName := repo.GetName()
-		rule, _, err := client.Repositories.GetBranchProtection(client.Ctx, client.Org, repoName, client.Branch)
-		if err != nil && rule != nil {
-			zap.S().Named("rules").Errorf("failed to get rule for repo %s: %v", repoName, err)
+// protectChange plans protecting the branch with the rule, keeping the
+// settings of the existing protection the rule does not model.
+func protectChange(target *repoBranch, action string, existing *github.Protection, current, desired *ProtectionRule) *Change {
+	repoName := target.Repo.GetName()
+	return &Change{
+		Repo:   repoName,
+		Target: target.Branch,
+		Action: action,
+		Fields: diffProtection(current, desired),
+		apply: func(client *auth.GithubClient) error {
+			zap.S().Named("rules").Debugf("adding rule for branch %s to repo %s", target.Branch, repoName)
+			_, _, err := client.Repositories.UpdateBranchProtection(client.Ctx, client.Org, repoName, target.Branch, desired.request(existing))
+			if err == nil && requiresSignatures(existing) {
+				_, _, err = client.Repositories.RequireSignaturesOnProtectedBranch(client.Ctx, client.Org, repoName, target.Branch)
+			}
+			if err == nil {
+				zap.S().Named("rules").Infof("applied %s to branch %s on repo %s/%s", action, target.Branch, client.Org, repoName)
+			}
+			return err
+		},
+	}
+}
+
+// PlanBranchRules plans adding branch protection to every branch matching
+// the release branches of the client, on all public, unarchived repositories
+// of the organization. The rule of each branch is taken from the first
+// matching profile. Branches that are already protected, or covered by an
+// organization ruleset, are left alone.
+func PlanBranchRules(client *auth.GithubClient, profiles []*ProtectionProfile) (*Plan, error) {
+	targets, err := gatherProtectionTargets(client)
+	if err != nil {
+		return nil, err
+	}
+
+	protections := make([]*github.Protection, len(targets))
+	covered := make([]bool, len(targets))
+	errs := forEach(client, len(targets), func(i int) error {
+		var err error
+		protections[i], err = getProtection(client, targets[i].Repo.GetName(), targets[i].Branch)
+		if err != nil || protections[i] != nil {
+			return err
+		}
+		covered[i], err = coveredByOrgRuleset(client, targets[i].Repo.GetName(), targets[i].Branch)
+		return err
+	})
+	if err := client.Ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	plan := &Plan{}
+	var hadError bool
+	for i, target := range targets {
+		repoName := target.Repo.GetName()
+		if errs[i] != nil {
+			zap.S().Named("rules").Errorf("failed to get rule for branch %s on repo %s: %v", target.Branch, repoName, errs[i])
+			hadError = true
 			continue
-		} else if rule != nil {
-			zap.S().Named("rules").Debugf("found valid rule for repo %s, skipping", repoName)
+		}
+		if protections[i] != nil {
+			zap.S().Named("rules").Debugf("found valid rule for branch %s on repo %s, skipping", target.Branch, repoName)
 			continue
 		}
-
-		requireConvRes := true
-		req := &github.ProtectionRequest{
-			RequiredPullRequestReviews: &github.PullRequestReviewsEnforcementRequest{
-				RequiredApprovingReviewCount: 1,
-				RequireCodeOwnerReviews:      true,
-			},
-			RequiredStatusChecks: &github.RequiredStatusChecks{
-				Checks: &[]*github.RequiredStatusCheck{
-					{
-						Context: "build-and-test / build-and-test",
-					},
-				},
-			},
-			RequiredConversationResolution: &requireConvRes,
-		}
-		zap.S().Named("rules").Debugf("adding rule to repo %s", repoName)
-		rule, _, err = client.Repositories.UpdateBranchProtection(client.Ctx, client.Org, repoName, client.Branch, req)
-		if err != nil {
-			zap.S().Named("rules").Errorf("failed to add release/2.7.x branch protection for repo %s: %v", repoName, err)
+		if covered[i] {
+			zap.S().Named("rules").Infof("branch %s on repo %s is covered by an organization ruleset, skipping", target.Branch, repoName)
+			continue
 		}
-		if rule != nil {
-			addedRepos = append(addedRepos, repo)
+
+		desired := ResolveProtection(profiles, repoName, target.Branch)
+		if desired == nil {
+			zap.S().Named("rules").Warnf("no protection profile matches branch %s on repo %s, skipping", target.Branch, repoName)
+			continue
 		}
+		plan.add(protectChange(target, "protect", nil, protectionRuleOf(nil), desired))
+	}
+	plan.sort()
+
+	if hadError {
+		return plan, errors.New("some branch rules could not be checked, see logs above")
 	}
-	return addedRepos, nil
+	return plan, nil
 }
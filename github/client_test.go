@@ -0,0 +1,169 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/go-github/v67/github"
+
+	"github.com/serenibyss/nhprtracker/auth"
+)
+
+// newTestClient creates a client of organization "org" sending its requests
+// to a local server.
+func newTestClient(t *testing.T, handler http.Handler) *auth.GithubClient {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	client := github.NewClient(server.Client())
+	baseURL, err := url.Parse(server.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.BaseURL = baseURL
+	return &auth.GithubClient{Client: client, Ctx: context.Background(), Org: "org"}
+}
+
+// fakeLabels serves the labels and labelled issues of a single repository
+// "org/repo" from memory.
+type fakeLabels struct {
+	mu     sync.Mutex
+	labels []*github.Label
+
+	// issues maps issue numbers to the names of their labels.
+	issues map[int][]string
+}
+
+func newFakeLabels(labels ...*github.Label) *fakeLabels {
+	return &fakeLabels{labels: labels, issues: map[int][]string{}}
+}
+
+func testLabel(name, color, desc string) *github.Label {
+	return &github.Label{Name: github.String(name), Color: github.String(color), Description: github.String(desc)}
+}
+
+func (f *fakeLabels) find(name string) int {
+	return slices.IndexFunc(f.labels, func(l *github.Label) bool { return strings.EqualFold(l.GetName(), name) })
+}
+
+// names returns the names of the labels of the repository.
+func (f *fakeLabels) names() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var names []string
+	for _, label := range f.labels {
+		names = append(names, label.GetName())
+	}
+	return names
+}
+
+func (f *fakeLabels) handler(t *testing.T) http.Handler {
+	writeJSON := func(w http.ResponseWriter, v any) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(v); err != nil {
+			t.Error(err)
+		}
+	}
+	issueNumber := func(r *http.Request) int {
+		n, err := strconv.Atoi(r.PathValue("number"))
+		if err != nil {
+			t.Errorf("malformed issue number in %s", r.URL)
+		}
+		return n
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /repos/org/repo/labels", func(w http.ResponseWriter, _ *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		writeJSON(w, f.labels)
+	})
+	mux.HandleFunc("GET /repos/org/repo/labels/{name}", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		i := f.find(r.PathValue("name"))
+		if i < 0 {
+			http.Error(w, `{"message": "Not Found"}`, http.StatusNotFound)
+			return
+		}
+		writeJSON(w, f.labels[i])
+	})
+	mux.HandleFunc("POST /repos/org/repo/labels", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		var label github.Label
+		if err := json.NewDecoder(r.Body).Decode(&label); err != nil {
+			t.Error(err)
+		}
+		f.labels = append(f.labels, &label)
+		writeJSON(w, label)
+	})
+	mux.HandleFunc("PATCH /repos/org/repo/labels/{name}", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		i := f.find(r.PathValue("name"))
+		if i < 0 {
+			http.Error(w, `{"message": "Not Found"}`, http.StatusNotFound)
+			return
+		}
+		var label github.Label
+		if err := json.NewDecoder(r.Body).Decode(&label); err != nil {
+			t.Error(err)
+		}
+		f.labels[i] = &label
+		writeJSON(w, label)
+	})
+	mux.HandleFunc("DELETE /repos/org/repo/labels/{name}", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		i := f.find(r.PathValue("name"))
+		if i < 0 {
+			http.Error(w, `{"message": "Not Found"}`, http.StatusNotFound)
+			return
+		}
+		f.labels = slices.Delete(f.labels, i, i+1)
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("GET /repos/org/repo/issues", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if r.URL.Query().Get("state") != "all" {
+			t.Errorf("issues listed without state=all: %s", r.URL)
+		}
+		issues := []*github.Issue{}
+		for number, labels := range f.issues {
+			if slices.ContainsFunc(labels, func(l string) bool { return strings.EqualFold(l, r.URL.Query().Get("labels")) }) {
+				issues = append(issues, &github.Issue{Number: github.Int(number)})
+			}
+		}
+		writeJSON(w, issues)
+	})
+	mux.HandleFunc("POST /repos/org/repo/issues/{number}/labels", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		var labels []string
+		if err := json.NewDecoder(r.Body).Decode(&labels); err != nil {
+			t.Error(err)
+		}
+		number := issueNumber(r)
+		f.issues[number] = append(f.issues[number], labels...)
+		writeJSON(w, []*github.Label{})
+	})
+	mux.HandleFunc("DELETE /repos/org/repo/issues/{number}/labels/{name}", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		number := issueNumber(r)
+		f.issues[number] = slices.DeleteFunc(f.issues[number], func(l string) bool { return strings.EqualFold(l, r.PathValue("name")) })
+		w.WriteHeader(http.StatusNoContent)
+	})
+	return mux
+}
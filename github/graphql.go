@@ -0,0 +1,569 @@
+package github
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v67/github"
+	"go.uber.org/zap"
+
+	"github.com/serenibyss/nhprtracker/auth"
+)
+
+// Number of repositories queried together in a single GraphQL request. Queries
+// returning more nodes per repository use smaller batches to stay well within
+// GitHub's node limits.
+const (
+	graphqlRefBatchSize     = 50
+	graphqlPRBatchSize      = 10
+	graphqlHistoryBatchSize = 10
+	graphqlLabelBatchSize   = 10
+)
+
+type graphqlError struct {
+	Message string `json:"message"`
+
+	// Path locates the field that failed, starting with the alias of the
+	// repository lookup.
+	Path []any `json:"path"`
+}
+
+type graphqlResponse[T any] struct {
+	Data   map[string]*T  `json:"data"`
+	Errors []graphqlError `json:"errors"`
+}
+
+type graphqlPageInfo struct {
+	HasNextPage bool   `json:"hasNextPage"`
+	EndCursor   string `json:"endCursor"`
+}
+
+type graphqlPullRequest struct {
+	Number      int       `json:"number"`
+	Title       string    `json:"title"`
+	URL         string    `json:"url"`
+	Body        string    `json:"body"`
+	MergedAt    time.Time `json:"mergedAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+	BaseRefName string    `json:"baseRefName"`
+	MergeCommit *struct {
+		OID string `json:"oid"`
+	} `json:"mergeCommit"`
+	Author *struct {
+		Typename string `json:"__typename"`
+		Login    string `json:"login"`
+	} `json:"author"`
+	Labels struct {
+		TotalCount int `json:"totalCount"`
+		Nodes      []struct {
+			Name string `json:"name"`
+		} `json:"nodes"`
+	} `json:"labels"`
+}
+
+type graphqlCommit struct {
+	OID     string `json:"oid"`
+	Message string `json:"message"`
+}
+
+type graphqlLabel struct {
+	Name        string `json:"name"`
+	Color       string `json:"color"`
+	Description string `json:"description"`
+	Issues      struct {
+		TotalCount int `json:"totalCount"`
+	} `json:"issues"`
+	PullRequests struct {
+		TotalCount int `json:"totalCount"`
+	} `json:"pullRequests"`
+}
+
+type graphqlRepository struct {
+	Ref *struct {
+		Name   string `json:"name"`
+		Target *struct {
+			History *struct {
+				PageInfo graphqlPageInfo `json:"pageInfo"`
+				Nodes    []graphqlCommit `json:"nodes"`
+			} `json:"history"`
+		} `json:"target"`
+	} `json:"ref"`
+	PullRequests *struct {
+		PageInfo graphqlPageInfo      `json:"pageInfo"`
+		Nodes    []graphqlPullRequest `json:"nodes"`
+	} `json:"pullRequests"`
+	Labels *struct {
+		PageInfo graphqlPageInfo `json:"pageInfo"`
+		Nodes    []graphqlLabel  `json:"nodes"`
+	} `json:"labels"`
+}
+
+// queryGraphQL runs a GraphQL query whose top level fields are aliased
+// repository lookups, returning the repositories keyed by alias. Errors of a
+// single lookup, like a missing repository, are returned keyed by its alias
+// along with the data of the others. The error is only set if the query as a
+// whole failed.
+func queryGraphQL(client *auth.GithubClient, query string, vars map[string]any) (map[string]*graphqlRepository, map[string]error, error) {
+	req, err := client.NewRequest(http.MethodPost, "graphql", map[string]any{
+		"query":     query,
+		"variables": vars,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var resp graphqlResponse[graphqlRepository]
+	if _, err := client.Do(client.Ctx, req, &resp); err != nil {
+		return nil, nil, err
+	}
+
+	aliasErrs := map[string]error{}
+	var messages []string
+	for _, e := range resp.Errors {
+		alias, ok := "", len(e.Path) != 0
+		if ok {
+			alias, ok = e.Path[0].(string)
+		}
+		if !ok {
+			messages = append(messages, e.Message)
+			continue
+		}
+		aliasErrs[alias] = errors.Join(aliasErrs[alias], fmt.Errorf("graphql query failed: %s", e.Message))
+	}
+	if len(messages) != 0 {
+		return resp.Data, aliasErrs, fmt.Errorf("graphql query failed: %s", strings.Join(messages, "; "))
+	}
+	return resp.Data, aliasErrs, nil
+}
+
+// graphqlString quotes a value for use as a GraphQL string literal.
+func graphqlString(value string) string {
+	quoted, _ := json.Marshal(value)
+	return string(quoted)
+}
+
+// repoAlias is the alias of the i-th repository in a batched query.
+func repoAlias(i int) string {
+	return fmt.Sprintf("r%d", i)
+}
+
+// batches splits [0, n) into consecutive ranges of at most size elements.
+func batches(n, size int) [][2]int {
+	var result [][2]int
+	for start := 0; start < n; start += size {
+		result = append(result, [2]int{start, min(start+size, n)})
+	}
+	return result
+}
+
+// gatherReleaseRepositoriesGraphQL checks which repositories have the release
+// branch by looking up the branch ref of many repositories per query.
+func gatherReleaseRepositoriesGraphQL(client *auth.GithubClient, repos []*github.Repository) (map[string]*github.Repository, error) {
+	patchRepos := map[string]*github.Repository{}
+	hasBranch := make([]bool, len(repos))
+	repoErrs := make([]error, len(repos))
+
+	ranges := batches(len(repos), graphqlRefBatchSize)
+	errs := forEach(client, len(ranges), func(b int) error {
+		var query strings.Builder
+		query.WriteString("query($owner: String!, $branch: String!) {\n")
+		for i := ranges[b][0]; i < ranges[b][1]; i++ {
+			fmt.Fprintf(&query, "  %s: repository(owner: $owner, name: %s) { ref(qualifiedName: $branch) { name } }\n",
+				repoAlias(i), graphqlString(repos[i].GetName()))
+		}
+		query.WriteString("}")
+
+		data, aliasErrs, err := queryGraphQL(client, query.String(), map[string]any{
+			"owner":  client.Org,
+			"branch": "refs/heads/" + client.Branch,
+		})
+		if err != nil {
+			return err
+		}
+		for i := ranges[b][0]; i < ranges[b][1]; i++ {
+			if repoErrs[i] = aliasErrs[repoAlias(i)]; repoErrs[i] != nil {
+				continue
+			}
+			if repo := data[repoAlias(i)]; repo != nil && repo.Ref != nil {
+				hasBranch[i] = true
+			}
+		}
+		return nil
+	})
+	if err := client.Ctx.Err(); err != nil {
+		return patchRepos, err
+	}
+
+	var hadError bool
+	for b, err := range errs {
+		if err != nil {
+			zap.S().Named("github").Errorf("failed to check release branches for repos %d-%d: %v", ranges[b][0]+1, ranges[b][1], err)
+			hadError = true
+		}
+	}
+	for i, repo := range repos {
+		if repoErrs[i] != nil {
+			zap.S().Named("github").Errorf("failed to check release branch for repo %s/%s: %v", client.Org, repo.GetName(), repoErrs[i])
+			hadError = true
+			continue
+		}
+		if hasBranch[i] {
+			zap.S().Named("github").Debugf("found patch repo %s", repo.GetName())
+			patchRepos[client.Org+"/"+repo.GetName()] = repo
+		}
+	}
+
+	if hadError {
+		return patchRepos, errors.New("some repo branches could not be checked, see logs above")
+	}
+	return patchRepos, nil
+}
+
+// gatherMergedPRsGraphQL fetches the merged PRs of many repositories per
+// query, following the pages of each repository until PRs last updated before
+// the start of its window are reached.
+func gatherMergedPRsGraphQL(client *auth.GithubClient, repos []*github.Repository) (map[string][]*github.PullRequest, error) {
+	prMap := make(map[string][]*github.PullRequest)
+	results := make([][]*github.PullRequest, len(repos))
+	errs := make([]error, len(repos))
+	cursors := make([]string, len(repos))
+
+	pending := make([]int, len(repos))
+	for i := range repos {
+		pending[i] = i
+	}
+
+	for len(pending) != 0 {
+		ranges := batches(len(pending), graphqlPRBatchSize)
+		more := make([][]int, len(ranges))
+		batchErrs := forEach(client, len(ranges), func(b int) error {
+			batch := pending[ranges[b][0]:ranges[b][1]]
+
+			var query strings.Builder
+			query.WriteString("query($owner: String!) {\n")
+			for _, i := range batch {
+				after := "null"
+				if cursors[i] != "" {
+					after = graphqlString(cursors[i])
+				}
+				fmt.Fprintf(&query, `  %s: repository(owner: $owner, name: %s) {
+    pullRequests(states: MERGED, first: 50, after: %s, orderBy: {field: UPDATED_AT, direction: DESC}) {
+      pageInfo { hasNextPage endCursor }
+      nodes {
+        number title url body mergedAt updatedAt baseRefName
+        mergeCommit { oid }
+        author { __typename login }
+        labels(first: 100) { totalCount nodes { name } }
+      }
+    }
+  }
+`, repoAlias(i), graphqlString(repos[i].GetName()), after)
+			}
+			query.WriteString("}")
+
+			data, aliasErrs, err := queryGraphQL(client, query.String(), map[string]any{"owner": client.Org})
+			if err != nil {
+				return err
+			}
+
+			for _, i := range batch {
+				if errs[i] = aliasErrs[repoAlias(i)]; errs[i] != nil {
+					continue
+				}
+				repo := data[repoAlias(i)]
+				if repo == nil || repo.PullRequests == nil {
+					continue
+				}
+
+				window := client.Window(repos[i].GetName())
+				done := false
+				for _, node := range repo.PullRequests.Nodes {
+					// sorted by update time, so every remaining PR was merged before the window
+					if node.UpdatedAt.Before(window.Start) {
+						done = true
+						break
+					}
+					if !window.Contains(node.MergedAt) {
+						continue
+					}
+
+					pr := node.toPullRequest()
+					// labels are matched by exclusions and label policies, so
+					// list the ones past the first page of the query
+					if node.Labels.TotalCount > len(node.Labels.Nodes) {
+						labels, err := listIssueLabels(client, repos[i].GetName(), pr.GetNumber())
+						if err != nil {
+							errs[i] = fmt.Errorf("failed to list labels of PR #%d: %w", pr.GetNumber(), err)
+							done = true
+							break
+						}
+						pr.Labels = labels
+					}
+					if excludePR(client, pr) {
+						continue
+					}
+					zap.S().Debugf("found pr #%d (%s) for repo %s", pr.GetNumber(), pr.GetTitle(), repos[i].GetName())
+					results[i] = append(results[i], pr)
+				}
+
+				if !done && repo.PullRequests.PageInfo.HasNextPage {
+					cursors[i] = repo.PullRequests.PageInfo.EndCursor
+					more[b] = append(more[b], i)
+				}
+			}
+			return nil
+		})
+		if err := client.Ctx.Err(); err != nil {
+			return prMap, err
+		}
+
+		var next []int
+		for b, err := range batchErrs {
+			if err != nil {
+				for _, i := range pending[ranges[b][0]:ranges[b][1]] {
+					errs[i] = err
+				}
+			}
+			next = append(next, more[b]...)
+		}
+		pending = next
+	}
+
+	var hadError bool
+	for i, repo := range repos {
+		if errs[i] != nil {
+			zap.S().Named("github").Errorf("failed to list pull requests for repo %s/%s: %v", client.Org, repo.GetName(), errs[i])
+			hadError = true
+		}
+		if results[i] != nil {
+			zap.S().Named("github").Debugf("found %d PRs for repo %s", len(results[i]), repo.GetName())
+			prMap[client.Org+"/"+repo.GetName()] = results[i]
+		}
+	}
+
+	if hadError {
+		return prMap, errors.New("some repo PR lists could not be checked, see logs above")
+	}
+	return prMap, nil
+}
+
+// gatherCommitsGraphQL fetches the release branch history within the window
+// of many repositories per query. Errors are returned at the index of
+// the repository they affect.
+func gatherCommitsGraphQL(client *auth.GithubClient, repos []*github.Repository) ([][]*github.Commit, []error) {
+	commits := make([][]*github.Commit, len(repos))
+	errs := make([]error, len(repos))
+	cursors := make([]string, len(repos))
+
+	var pending []int
+	for i, repo := range repos {
+		if repo != nil {
+			pending = append(pending, i)
+		}
+	}
+
+	for len(pending) != 0 {
+		ranges := batches(len(pending), graphqlHistoryBatchSize)
+		more := make([][]int, len(ranges))
+		batchErrs := forEach(client, len(ranges), func(b int) error {
+			batch := pending[ranges[b][0]:ranges[b][1]]
+
+			var query strings.Builder
+			query.WriteString("query($owner: String!, $branch: String!) {\n")
+			for _, i := range batch {
+				after := "null"
+				if cursors[i] != "" {
+					after = graphqlString(cursors[i])
+				}
+				window := client.Window(repos[i].GetName())
+				until := "null"
+				if !window.End.IsZero() {
+					until = graphqlString(window.End.Format(time.RFC3339))
+				}
+				fmt.Fprintf(&query, `  %s: repository(owner: $owner, name: %s) {
+    ref(qualifiedName: $branch) {
+      name
+      target {
+        ... on Commit {
+          history(first: 100, since: %s, until: %s, after: %s) {
+            pageInfo { hasNextPage endCursor }
+            nodes { oid message }
+          }
+        }
+      }
+    }
+  }
+`, repoAlias(i), graphqlString(repos[i].GetName()), graphqlString(window.Start.Format(time.RFC3339)), until, after)
+			}
+			query.WriteString("}")
+
+			data, aliasErrs, err := queryGraphQL(client, query.String(), map[string]any{
+				"owner":  client.Org,
+				"branch": "refs/heads/" + client.Branch,
+			})
+			if err != nil {
+				return err
+			}
+
+			for _, i := range batch {
+				if err := aliasErrs[repoAlias(i)]; err != nil {
+					errs[i] = fmt.Errorf("failed to list commits for repo %s: %w", repos[i].GetName(), err)
+					continue
+				}
+				repo := data[repoAlias(i)]
+				if repo == nil || repo.Ref == nil || repo.Ref.Target == nil || repo.Ref.Target.History == nil {
+					continue
+				}
+				history := repo.Ref.Target.History
+				zap.S().Named("github").Debugf("found %d commits on branch %s for repo %s", len(history.Nodes), client.Branch, repos[i].GetName())
+				for _, node := range history.Nodes {
+					commits[i] = append(commits[i], &github.Commit{
+						SHA:     github.String(node.OID),
+						Message: github.String(node.Message),
+					})
+				}
+				if history.PageInfo.HasNextPage {
+					cursors[i] = history.PageInfo.EndCursor
+					more[b] = append(more[b], i)
+				}
+			}
+			return nil
+		})
+		if err := client.Ctx.Err(); err != nil {
+			for _, i := range pending {
+				errs[i] = err
+			}
+			return commits, errs
+		}
+
+		var next []int
+		for b, err := range batchErrs {
+			if err != nil {
+				for _, i := range pending[ranges[b][0]:ranges[b][1]] {
+					errs[i] = fmt.Errorf("failed to list commits for repo %s: %w", repos[i].GetName(), err)
+				}
+			}
+			next = append(next, more[b]...)
+		}
+		pending = next
+	}
+	return commits, errs
+}
+
+func (node *graphqlPullRequest) toPullRequest() *github.PullRequest {
+	pr := &github.PullRequest{
+		Number:   github.Int(node.Number),
+		Title:    github.String(node.Title),
+		HTMLURL:  github.String(node.URL),
+		Body:     github.String(node.Body),
+		MergedAt: &github.Timestamp{Time: node.MergedAt},
+		Base:     &github.PullRequestBranch{Ref: github.String(node.BaseRefName)},
+	}
+	if node.MergeCommit != nil {
+		pr.MergeCommitSHA = github.String(node.MergeCommit.OID)
+	}
+	if node.Author != nil {
+		// GraphQL leaves out the suffix REST gives the logins of apps
+		login := node.Author.Login
+		if node.Author.Typename == "Bot" {
+			login += "[bot]"
+		}
+		pr.User = &github.User{Login: github.String(login)}
+	}
+	for _, label := range node.Labels.Nodes {
+		pr.Labels = append(pr.Labels, &github.Label{Name: github.String(label.Name)})
+	}
+	return pr
+}
+
+// gatherLabelUsageGraphQL fetches the labels of many repositories per query,
+// along with the number of issues and PRs carrying each. Errors are returned
+// at the index of the repository they affect.
+func gatherLabelUsageGraphQL(client *auth.GithubClient, repos []*github.Repository) ([][]*LabelUsage, []error) {
+	usages := make([][]*LabelUsage, len(repos))
+	errs := make([]error, len(repos))
+	cursors := make([]string, len(repos))
+
+	pending := make([]int, len(repos))
+	for i := range repos {
+		pending[i] = i
+	}
+
+	for len(pending) != 0 {
+		ranges := batches(len(pending), graphqlLabelBatchSize)
+		more := make([][]int, len(ranges))
+		batchErrs := forEach(client, len(ranges), func(b int) error {
+			batch := pending[ranges[b][0]:ranges[b][1]]
+
+			var query strings.Builder
+			query.WriteString("query($owner: String!) {\n")
+			for _, i := range batch {
+				after := "null"
+				if cursors[i] != "" {
+					after = graphqlString(cursors[i])
+				}
+				fmt.Fprintf(&query, `  %s: repository(owner: $owner, name: %s) {
+    labels(first: 100, after: %s) {
+      pageInfo { hasNextPage endCursor }
+      nodes {
+        name color description
+        issues { totalCount }
+        pullRequests { totalCount }
+      }
+    }
+  }
+`, repoAlias(i), graphqlString(repos[i].GetName()), after)
+			}
+			query.WriteString("}")
+
+			data, aliasErrs, err := queryGraphQL(client, query.String(), map[string]any{"owner": client.Org})
+			if err != nil {
+				return err
+			}
+
+			for _, i := range batch {
+				if errs[i] = aliasErrs[repoAlias(i)]; errs[i] != nil {
+					continue
+				}
+				repo := data[repoAlias(i)]
+				if repo == nil || repo.Labels == nil {
+					continue
+				}
+				for _, node := range repo.Labels.Nodes {
+					usages[i] = append(usages[i], &LabelUsage{
+						Repo:         repos[i].GetName(),
+						Name:         node.Name,
+						Color:        node.Color,
+						Description:  node.Description,
+						Issues:       node.Issues.TotalCount,
+						PullRequests: node.PullRequests.TotalCount,
+					})
+				}
+				if repo.Labels.PageInfo.HasNextPage {
+					cursors[i] = repo.Labels.PageInfo.EndCursor
+					more[b] = append(more[b], i)
+				}
+			}
+			return nil
+		})
+		if err := client.Ctx.Err(); err != nil {
+			return usages, errs
+		}
+
+		var next []int
+		for b, err := range batchErrs {
+			if err != nil {
+				for _, i := range pending[ranges[b][0]:ranges[b][1]] {
+					errs[i] = err
+				}
+			}
+			next = append(next, more[b]...)
+		}
+		pending = next
+	}
+	return usages, errs
+}
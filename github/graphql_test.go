@@ -0,0 +1,112 @@
+package github
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v67/github"
+
+	"github.com/serenibyss/nhprtracker/auth"
+	"github.com/serenibyss/nhprtracker/internal"
+)
+
+// newGraphQLClient creates a client sending GraphQL queries to a local server
+// answering with the passed body.
+func newGraphQLClient(t *testing.T, body string) *auth.GithubClient {
+	t.Helper()
+	return newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/graphql" {
+			t.Errorf("unexpected request to %s", r.URL.Path)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(body))
+	}))
+}
+
+func TestQueryGraphQLAttributesErrorsToAliases(t *testing.T) {
+	client := newGraphQLClient(t, `{
+  "data": {"r0": {"ref": {"name": "main"}}, "r1": null, "r2": {"ref": null}},
+  "errors": [{"type": "NOT_FOUND", "path": ["r1"], "message": "Could not resolve to a Repository with the name 'org/gone'."}]
+}`)
+
+	data, aliasErrs, err := queryGraphQL(client, "query { }", nil)
+	if err != nil {
+		t.Fatalf("queryGraphQL: %v", err)
+	}
+	if data["r0"] == nil || data["r0"].Ref == nil {
+		t.Error("data of r0 was dropped")
+	}
+	if aliasErrs["r1"] == nil || !strings.Contains(aliasErrs["r1"].Error(), "org/gone") {
+		t.Errorf("got error %v for r1, want the not found error", aliasErrs["r1"])
+	}
+	if aliasErrs["r0"] != nil || aliasErrs["r2"] != nil {
+		t.Errorf("got errors for r0 or r2: %v", aliasErrs)
+	}
+}
+
+func TestQueryGraphQLFailsWithoutPath(t *testing.T) {
+	client := newGraphQLClient(t, `{"errors": [{"message": "Parse error on \"}\""}]}`)
+
+	if _, _, err := queryGraphQL(client, "query {", nil); err == nil {
+		t.Error("queryGraphQL succeeded, want error")
+	}
+}
+
+func TestGatherMergedPRsGraphQLKeepsOtherRepos(t *testing.T) {
+	merged := time.Now().UTC().Add(-time.Hour).Format(time.RFC3339)
+	client := newGraphQLClient(t, `{
+  "data": {
+    "r0": {"pullRequests": {"pageInfo": {"hasNextPage": false}, "nodes": [
+      {"number": 1, "title": "Fix thing", "mergedAt": "`+merged+`", "updatedAt": "`+merged+`", "labels": {"totalCount": 0, "nodes": []}}
+    ]}},
+    "r1": null
+  },
+  "errors": [{"path": ["r1"], "message": "Could not resolve to a Repository with the name 'org/gone'."}]
+}`)
+	client.Date = time.Now().UTC().Add(-24 * time.Hour)
+	repos := []*github.Repository{{Name: github.String("kept")}, {Name: github.String("gone")}}
+
+	prMap, err := gatherMergedPRsGraphQL(client, repos)
+	if err == nil {
+		t.Error("got no error for the missing repo")
+	}
+	if prs := prMap["org/kept"]; len(prs) != 1 || prs[0].GetNumber() != 1 {
+		t.Errorf("got PRs %v for the other repo, want #1", prs)
+	}
+}
+
+func TestToPullRequestAuthorLogin(t *testing.T) {
+	authors, err := internal.ParsePatterns(internal.ExcludedPRAuthors)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exclusions := &internal.Exclusions{Authors: authors}
+
+	tests := []struct {
+		typename string
+		login    string
+		want     string
+		excluded bool
+	}{
+		{"User", "alice", "alice", false},
+		{"Bot", "dependabot", "dependabot[bot]", true},
+		{"Bot", "github-actions", "github-actions[bot]", true},
+		{"Mannequin", "old-user", "old-user", false},
+	}
+	for _, tt := range tests {
+		node := &graphqlPullRequest{}
+		node.Author = &struct {
+			Typename string `json:"__typename"`
+			Login    string `json:"login"`
+		}{Typename: tt.typename, Login: tt.login}
+		got := node.toPullRequest().GetUser().GetLogin()
+		if got != tt.want {
+			t.Errorf("author %s %q got login %q, want %q", tt.typename, tt.login, got, tt.want)
+		}
+		if excluded := exclusions.ExcludePR("title", got, nil); excluded != tt.excluded {
+			t.Errorf("author %q excluded by default = %v, want %v", got, excluded, tt.excluded)
+		}
+	}
+}
@@ -2,6 +2,10 @@ package github
 
 import (
 	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/google/go-github/v67/github"
 	"go.uber.org/zap"
@@ -9,6 +13,10 @@ import (
 	"github.com/serenibyss/nhprtracker/auth"
 )
 
+// mergeProgressInterval is the number of issues and PRs relabelled between
+// progress reports of a merge.
+const mergeProgressInterval = 25
+
 type LabelData struct {
 	Name       string
 	OldName    string
@@ -17,72 +25,301 @@ type LabelData struct {
 	UpdateOnly bool
 }
 
-func CreateLabelOnRepositories(client *auth.GithubClient, repos []*github.Repository, data *LabelData) error {
+// PlanLabel plans creating or editing a label on the specified repositories.
+// Labels already matching the data are left alone.
+func PlanLabel(client *auth.GithubClient, repos []*github.Repository, data *LabelData) (*Plan, error) {
 	if data.UpdateOnly && data.OldName == "" {
-		return errors.New("could not update labels as no old name was specified")
+		return nil, errors.New("could not update labels as no old name was specified")
 	}
 
-	var hadError bool
+	changes := make([]*Change, len(repos))
+	errs := forEach(client, len(repos), func(i int) error {
+		var err error
+		changes[i], err = planLabelOnRepository(client, repos[i].GetName(), data)
+		return err
+	})
+	if err := client.Ctx.Err(); err != nil {
+		return nil, err
+	}
 
-	for _, repo := range repos {
-		err := createLabelOnRepository(client, repo, data)
-		if err != nil {
+	plan := &Plan{}
+	var hadError bool
+	for i, repo := range repos {
+		if errs[i] != nil {
+			zap.S().Named("github").Errorf("failed to check labels for %s/%s: %v", client.Org, repo.GetName(), errs[i])
 			hadError = true
+			continue
+		}
+		if changes[i] != nil {
+			plan.add(changes[i])
 		}
 	}
+	plan.sort()
 
 	if hadError {
-		return errors.New("some repos could not have the label added/updated, see logs above")
+		return plan, errors.New("some repos could not have the label checked, see logs above")
+	}
+	return plan, nil
+}
+
+// getLabel returns the label with the name on the repository, or nil if it
+// does not exist.
+func getLabel(client *auth.GithubClient, repoName, name string) (*github.Label, error) {
+	label, resp, err := client.Issues.GetLabel(client.Ctx, client.Org, repoName, name)
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return nil, nil
+		}
+		return nil, err
 	}
-	return nil
+	return label, nil
 }
 
-func createLabelOnRepository(client *auth.GithubClient, repo *github.Repository, data *LabelData) error {
+// planLabelOnRepository plans renaming the label with the old name of the
+// data, or creating or updating the label with its name when there is no old
+// name. Renaming a label the repository does not have is an error.
+func planLabelOnRepository(client *auth.GithubClient, repoName string, data *LabelData) (*Change, error) {
 	if data.OldName != "" {
-		label, _, err := client.Issues.GetLabel(client.Ctx, client.Org, repo.GetName(), data.OldName)
+		label, err := getLabel(client, repoName, data.OldName)
 		if err != nil {
-			zap.S().Named("github").Errorf("failed to get label with name %s for %s/%s: %v", data.OldName, client.Org, repo.GetName(), err)
-			return err
+			return nil, err
 		}
-
 		if label != nil {
-			label.Name = &data.Name
-			if data.Color != "" {
-				label.Color = &data.Color
-			}
-			if data.Desc != "" {
-				label.Description = &data.Desc
+			change := editLabelChange(repoName, "rename-label", label, data.Name, data.Color, data.Desc)
+			if len(change.Fields) == 0 {
+				return nil, nil
 			}
+			return change, nil
+		}
+		// a mistyped old name must not create a stray label instead
+		return nil, fmt.Errorf("no label with name %s to rename", data.OldName)
+	}
 
-			_, _, err = client.Issues.EditLabel(client.Ctx, client.Org, repo.GetName(), data.OldName, label)
-			if err != nil {
-				zap.S().Named("github").Errorf("failed to update label for %s/%s: %v", client.Org, repo.GetName(), err)
-				return err
+	label, err := getLabel(client, repoName, data.Name)
+	if err != nil {
+		return nil, err
+	}
+	if label != nil {
+		change := editLabelChange(repoName, "update-label", label, data.Name, data.Color, data.Desc)
+		if len(change.Fields) == 0 {
+			return nil, nil
+		}
+		if len(change.Fields) == 1 && change.Fields[0].Field == "color" {
+			change.Action = "recolor-label"
+		}
+		return change, nil
+	}
+
+	return createLabelChange(repoName, data.Name, data.Color, data.Desc), nil
+}
+
+// createLabelChange plans creating a label.
+func createLabelChange(repoName, name, color, desc string) *Change {
+	change := &Change{
+		Repo:   repoName,
+		Target: name,
+		Action: "create-label",
+		Fields: []FieldChange{{Field: "name", Current: unsetField, Desired: name}},
+		apply: func(client *auth.GithubClient) error {
+			label := &github.Label{
+				Name: github.String(name),
 			}
-			zap.S().Named("github").Infof("updated label with name %s to name %s on repo %s/%s", data.OldName, data.Name, client.Org, repo.GetName())
-			return nil
+			if color != "" {
+				label.Color = github.String(strings.TrimPrefix(color, "#"))
+			}
+			if desc != "" {
+				label.Description = github.String(desc)
+			}
+			_, _, err := client.Issues.CreateLabel(client.Ctx, client.Org, repoName, label)
+			if err == nil {
+				zap.S().Named("github").Infof("created label with name %s on repo %s/%s", name, client.Org, repoName)
+			}
+			return err
+		},
+	}
+	if color != "" {
+		change.Fields = append(change.Fields, FieldChange{Field: "color", Current: unsetField, Desired: color})
+	}
+	if desc != "" {
+		change.Fields = append(change.Fields, FieldChange{Field: "description", Current: unsetField, Desired: desc})
+	}
+	return change
+}
+
+// editLabelChange plans changing the name, color and description of an
+// existing label. Empty values are left as they are.
+func editLabelChange(repoName, action string, label *github.Label, name, color, desc string) *Change {
+	oldName := label.GetName()
+	change := &Change{
+		Repo:   repoName,
+		Target: oldName,
+		Action: action,
+	}
+
+	edited := &github.Label{
+		Name:        github.String(oldName),
+		Color:       label.Color,
+		Description: label.Description,
+	}
+	if name != "" && name != oldName {
+		change.Fields = append(change.Fields, FieldChange{Field: "name", Current: oldName, Desired: name})
+		edited.Name = github.String(name)
+	}
+	if color != "" && !equalColor(color, label.GetColor()) {
+		change.Fields = append(change.Fields, FieldChange{Field: "color", Current: label.GetColor(), Desired: color})
+		edited.Color = github.String(strings.TrimPrefix(color, "#"))
+	}
+	if desc != "" && desc != label.GetDescription() {
+		change.Fields = append(change.Fields, FieldChange{Field: "description", Current: label.GetDescription(), Desired: desc})
+		edited.Description = github.String(desc)
+	}
+
+	change.apply = func(client *auth.GithubClient) error {
+		_, _, err := client.Issues.EditLabel(client.Ctx, client.Org, repoName, oldName, edited)
+		if err == nil {
+			zap.S().Named("github").Infof("updated label with name %s to name %s on repo %s/%s", oldName, edited.GetName(), client.Org, repoName)
 		}
+		return err
 	}
+	return change
+}
+
+// equalColor compares label colors, which GitHub stores in lower case and
+// without a leading '#'.
+func equalColor(a, b string) bool {
+	return strings.EqualFold(strings.TrimPrefix(a, "#"), strings.TrimPrefix(b, "#"))
+}
 
-	if data.UpdateOnly {
-		return nil
+// PlanLabelMerge plans moving the issues and PRs carrying the label from onto
+// the label into on the specified repositories, then deleting from. Where into
+// does not exist yet, from is renamed instead. Merging again after an
+// interruption picks up the issues and PRs left.
+func PlanLabelMerge(client *auth.GithubClient, repos []*github.Repository, from, into string) (*Plan, error) {
+	if from == "" || into == "" {
+		return nil, errors.New("could not merge labels as the label to merge from or into was not specified")
+	}
+	if strings.EqualFold(from, into) {
+		return nil, fmt.Errorf("could not merge label %s into itself", from)
+	}
+
+	changes := make([]*Change, len(repos))
+	errs := forEach(client, len(repos), func(i int) error {
+		var err error
+		changes[i], err = planLabelMergeOnRepository(client, repos[i].GetName(), from, into)
+		return err
+	})
+	if err := client.Ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	plan := &Plan{}
+	var hadError bool
+	for i, repo := range repos {
+		if errs[i] != nil {
+			zap.S().Named("github").Errorf("failed to check labels for %s/%s: %v", client.Org, repo.GetName(), errs[i])
+			hadError = true
+			continue
+		}
+		if changes[i] != nil {
+			plan.add(changes[i])
+		}
 	}
+	plan.sort()
 
-	label := &github.Label{
-		Name: &data.Name,
+	if hadError {
+		return plan, errors.New("some repos could not have the labels checked, see logs above")
 	}
-	if data.Color != "" {
-		label.Color = &data.Color
+	return plan, nil
+}
+
+func planLabelMergeOnRepository(client *auth.GithubClient, repoName, from, into string) (*Change, error) {
+	fromLabel, err := getLabel(client, repoName, from)
+	if err != nil {
+		return nil, err
 	}
-	if data.Desc != "" {
-		label.Description = &data.Desc
+	if fromLabel == nil {
+		zap.S().Named("github").Debugf("no label with name %s on repo %s/%s", from, client.Org, repoName)
+		return nil, nil
 	}
 
-	_, _, err := client.Issues.CreateLabel(client.Ctx, client.Org, repo.GetName(), label)
+	intoLabel, err := getLabel(client, repoName, into)
 	if err != nil {
-		zap.S().Named("github").Errorf("failed to create label for %s/%s: %v", client.Org, repo.GetName(), err)
-		return err
+		return nil, err
+	}
+	if intoLabel == nil {
+		return editLabelChange(repoName, "rename-label", fromLabel, into, "", ""), nil
+	}
+
+	issues, err := listLabelledIssues(client, repoName, fromLabel.GetName())
+	if err != nil {
+		return nil, err
+	}
+	return mergeLabelChange(repoName, fromLabel.GetName(), intoLabel.GetName(), len(issues)), nil
+}
+
+// mergeLabelChange plans relabelling the issues and PRs carrying the label
+// from with into, then deleting from. Issues are listed again when applied,
+// so ones labelled since the plan are moved too.
+func mergeLabelChange(repoName, from, into string, count int) *Change {
+	return &Change{
+		Repo:   repoName,
+		Target: from,
+		Action: "merge-label",
+		Fields: []FieldChange{
+			{Field: "name", Current: from, Desired: into},
+			{Field: "labelled issues and PRs", Current: strconv.Itoa(count), Desired: "0"},
+		},
+		apply: func(client *auth.GithubClient) error {
+			issues, err := listLabelledIssues(client, repoName, from)
+			if err != nil {
+				return err
+			}
+
+			for i, number := range issues {
+				if _, _, err := client.Issues.AddLabelsToIssue(client.Ctx, client.Org, repoName, number, []string{into}); err != nil {
+					return fmt.Errorf("failed to add label %s to #%d: %w", into, number, err)
+				}
+				if _, err := client.Issues.RemoveLabelForIssue(client.Ctx, client.Org, repoName, number, from); err != nil {
+					return fmt.Errorf("failed to remove label %s from #%d: %w", from, number, err)
+				}
+				if done := i + 1; done%mergeProgressInterval == 0 && done != len(issues) {
+					zap.S().Named("github").Infof("relabelled %d of %d issues and PRs from %s to %s on repo %s/%s", done, len(issues), from, into, client.Org, repoName)
+				}
+			}
+			zap.S().Named("github").Infof("relabelled %d issues and PRs from %s to %s on repo %s/%s", len(issues), from, into, client.Org, repoName)
+
+			if _, err := client.Issues.DeleteLabel(client.Ctx, client.Org, repoName, from); err != nil {
+				return fmt.Errorf("failed to delete label %s: %w", from, err)
+			}
+			zap.S().Named("github").Infof("merged label with name %s into %s on repo %s/%s", from, into, client.Org, repoName)
+			return nil
+		},
+	}
+}
+
+// listLabelledIssues lists the numbers of every open and closed issue and PR
+// carrying the label.
+func listLabelledIssues(client *auth.GithubClient, repoName, label string) ([]int, error) {
+	var numbers []int
+	opts := &github.IssueListByRepoOptions{
+		State:       "all",
+		Labels:      []string{label},
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+
+	for {
+		issues, resp, err := client.Issues.ListByRepo(client.Ctx, client.Org, repoName, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, issue := range issues {
+			numbers = append(numbers, issue.GetNumber())
+		}
+
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
 	}
-	zap.S().Named("github").Infof("created label with name %s on repo %s/%s", data.Name, client.Org, repo.GetName())
-	return nil
+	return numbers, nil
 }
@@ -0,0 +1,177 @@
+package github
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/google/go-github/v67/github"
+)
+
+// plannedChanges returns copies of the changes without their apply funcs, so
+// they can be compared.
+func plannedChanges(changes ...*Change) []Change {
+	var planned []Change
+	for _, change := range changes {
+		if change == nil {
+			continue
+		}
+		c := *change
+		c.apply = nil
+		planned = append(planned, c)
+	}
+	return planned
+}
+
+func TestPlanLabelOnRepository(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    *LabelData
+		want    []Change
+		wantErr bool
+	}{
+		{
+			name: "rename",
+			data: &LabelData{Name: "type: bug", OldName: "Bug"},
+			want: []Change{{Repo: "repo", Target: "bug", Action: "rename-label", Fields: []FieldChange{
+				{Field: "name", Current: "bug", Desired: "type: bug"},
+			}}},
+		},
+		{
+			name:    "rename missing label",
+			data:    &LabelData{Name: "type: bug", OldName: "bugg"},
+			wantErr: true,
+		},
+		{
+			name:    "update missing label",
+			data:    &LabelData{Name: "type: bug", OldName: "bugg", Color: "d73a4a", UpdateOnly: true},
+			wantErr: true,
+		},
+		{
+			name: "create",
+			data: &LabelData{Name: "type: bug", Color: "#d73a4a"},
+			want: []Change{{Repo: "repo", Target: "type: bug", Action: "create-label", Fields: []FieldChange{
+				{Field: "name", Current: unsetField, Desired: "type: bug"},
+				{Field: "color", Current: unsetField, Desired: "#d73a4a"},
+			}}},
+		},
+		{
+			name: "recolor",
+			data: &LabelData{Name: "bug", Color: "#D73A4A"},
+			want: []Change{{Repo: "repo", Target: "bug", Action: "recolor-label", Fields: []FieldChange{
+				{Field: "color", Current: "ffffff", Desired: "#D73A4A"},
+			}}},
+		},
+		{
+			name: "unchanged",
+			data: &LabelData{Name: "bug", Color: "FFFFFF", Desc: "Something is broken"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			labels := newFakeLabels(testLabel("bug", "ffffff", "Something is broken"))
+			client := newTestClient(t, labels.handler(t))
+
+			change, err := planLabelOnRepository(client, "repo", tt.data)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("planLabelOnRepository() planned %+v, want error", change)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := plannedChanges(change); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("planLabelOnRepository() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlanLabelMergeOnRepository(t *testing.T) {
+	tests := []struct {
+		name     string
+		from     string
+		into     string
+		want     []Change
+		wantFrom []string
+	}{
+		{
+			name: "target exists",
+			from: "enhancement",
+			into: "Type: Feature",
+			want: []Change{{Repo: "repo", Target: "enhancement", Action: "merge-label", Fields: []FieldChange{
+				{Field: "name", Current: "enhancement", Desired: "type: feature"},
+				{Field: "labelled issues and PRs", Current: "2", Desired: "0"},
+			}}},
+		},
+		{
+			name: "target missing",
+			from: "enhancement",
+			into: "type: enhancement",
+			want: []Change{{Repo: "repo", Target: "enhancement", Action: "rename-label", Fields: []FieldChange{
+				{Field: "name", Current: "enhancement", Desired: "type: enhancement"},
+			}}},
+		},
+		{
+			name: "source missing",
+			from: "feature request",
+			into: "type: feature",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			labels := newFakeLabels(testLabel("enhancement", "a2eeef", ""), testLabel("type: feature", "00ff00", ""))
+			labels.issues[1] = []string{"enhancement"}
+			labels.issues[2] = []string{"bug", "enhancement"}
+			client := newTestClient(t, labels.handler(t))
+
+			change, err := planLabelMergeOnRepository(client, "repo", tt.from, tt.into)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := plannedChanges(change); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("planLabelMergeOnRepository() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergeLabelChangeApply(t *testing.T) {
+	labels := newFakeLabels(testLabel("enhancement", "a2eeef", ""), testLabel("type: feature", "00ff00", ""))
+	labels.issues[1] = []string{"enhancement"}
+	labels.issues[2] = []string{"bug", "enhancement"}
+	labels.issues[3] = []string{"type: feature"}
+	client := newTestClient(t, labels.handler(t))
+
+	// issue 1 was planned, issue 2 labelled since
+	if err := mergeLabelChange("repo", "enhancement", "type: feature", 1).apply(client); err != nil {
+		t.Fatal(err)
+	}
+
+	wantIssues := map[int][]string{
+		1: {"type: feature"},
+		2: {"bug", "type: feature"},
+		3: {"type: feature"},
+	}
+	if !reflect.DeepEqual(labels.issues, wantIssues) {
+		t.Errorf("issues labelled %v, want %v", labels.issues, wantIssues)
+	}
+	if got, want := labels.names(), []string{"type: feature"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("labels left %v, want %v", got, want)
+	}
+}
+
+func TestPlanLabelMergeIntoItself(t *testing.T) {
+	client := newTestClient(t, http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected request to %s", r.URL.Path)
+	}))
+	repos := []*github.Repository{{Name: github.String("repo")}}
+
+	for _, into := range []string{"enhancement", "Enhancement"} {
+		if plan, err := PlanLabelMerge(client, repos, "enhancement", into); err == nil {
+			t.Errorf("PlanLabelMerge(enhancement, %s) = %+v, want error", into, plannedChanges(plan.Changes...))
+		}
+	}
+}
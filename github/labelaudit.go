@@ -0,0 +1,299 @@
+package github
+
+import (
+	"cmp"
+	"errors"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/google/go-github/v67/github"
+	"go.uber.org/zap"
+
+	"github.com/serenibyss/nhprtracker/auth"
+)
+
+// LabelUsage is a label of a repository and how often it is used.
+type LabelUsage struct {
+	Repo         string `json:"repo"`
+	Name         string `json:"name"`
+	Color        string `json:"color"`
+	Description  string `json:"description,omitempty"`
+	Issues       int    `json:"issues"`
+	PullRequests int    `json:"pull_requests"`
+}
+
+// Uses is the number of issues and PRs carrying the label.
+func (u *LabelUsage) Uses() int {
+	return u.Issues + u.PullRequests
+}
+
+// LabelCluster groups labels across repositories whose names are likely
+// meant to be the same label.
+type LabelCluster struct {
+	// Name is the suggested name of the label, the most used variant.
+	Name        string `json:"name"`
+	Color       string `json:"color"`
+	Description string `json:"description,omitempty"`
+
+	// Variants holds every distinct name of the labels in the cluster.
+	Variants []string      `json:"variants"`
+	Labels   []*LabelUsage `json:"labels"`
+}
+
+// Uses is the number of issues and PRs carrying any label of the cluster.
+func (c *LabelCluster) Uses() int {
+	var uses int
+	for _, label := range c.Labels {
+		uses += label.Uses()
+	}
+	return uses
+}
+
+// SuggestLabelManifest returns a labels manifest suggested by the clusters,
+// with one label per cluster aliased by its other variants.
+func SuggestLabelManifest(clusters []*LabelCluster) *LabelManifest {
+	manifest := &LabelManifest{}
+	for _, cluster := range clusters {
+		spec := &LabelSpec{
+			Name:        cluster.Name,
+			Color:       cluster.Color,
+			Description: cluster.Description,
+		}
+		// Variants only differing in case are the same label to GitHub
+		seen := map[string]bool{strings.ToLower(cluster.Name): true}
+		for _, variant := range cluster.Variants {
+			if !seen[strings.ToLower(variant)] {
+				seen[strings.ToLower(variant)] = true
+				spec.Aliases = append(spec.Aliases, variant)
+			}
+		}
+		manifest.Labels = append(manifest.Labels, spec)
+	}
+	return manifest
+}
+
+// AuditLabels lists the labels of the repositories with their usage, grouping
+// near-duplicate names into clusters. Clusters are sorted by usage, most used
+// first.
+func AuditLabels(client *auth.GithubClient, repos []*github.Repository) ([]*LabelCluster, error) {
+	usages, errs := gatherLabelUsageGraphQL(client, repos)
+	if err := client.Ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var labels []*LabelUsage
+	var hadError bool
+	for i, repo := range repos {
+		if errs[i] != nil {
+			zap.S().Named("github").Errorf("failed to list labels for repo %s/%s: %v", client.Org, repo.GetName(), errs[i])
+			hadError = true
+			continue
+		}
+		labels = append(labels, usages[i]...)
+	}
+
+	clusters := clusterLabels(labels)
+	if hadError {
+		return clusters, errors.New("some repo labels could not be listed, see logs above")
+	}
+	return clusters, nil
+}
+
+// normalizeLabel reduces a label name to the form near-duplicates share:
+// lower case, with hyphens, underscores and repeated spaces folded into a
+// single space.
+func normalizeLabel(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r == '-' || r == '_' {
+			return ' '
+		}
+		return r
+	}, strings.ToLower(name))
+	return strings.Join(strings.Fields(name), " ")
+}
+
+// typoDistance is the edit distance under which two normalized names are
+// considered the same label. Short names allow no typos, as they are too
+// easily confused with other words.
+func typoDistance(a, b string) int {
+	switch n := min(len(a), len(b)); {
+	case n < 4:
+		return 0
+	case n < 8:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// labelTokens splits a normalized name into runs of letters and single
+// other runes, like digits, spaces and punctuation.
+func labelTokens(name string) []string {
+	var tokens []string
+	start := -1
+	for i, r := range name {
+		if unicode.IsLetter(r) {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		if start >= 0 {
+			tokens = append(tokens, name[start:i])
+			start = -1
+		}
+		tokens = append(tokens, string(r))
+	}
+	if start >= 0 {
+		tokens = append(tokens, name[start:])
+	}
+	return tokens
+}
+
+// isTypo checks if two normalized names only differ by typos. Typos are only
+// counted within words of several letters, so names differing by a number,
+// a separator or a single letter, like "tier 1" and "tier 2" or "size/s" and
+// "size/m", are different labels.
+func isTypo(a, b string) bool {
+	ta, tb := labelTokens(a), labelTokens(b)
+	if len(ta) != len(tb) {
+		return false
+	}
+	var edits int
+	for i := range ta {
+		if ta[i] == tb[i] {
+			continue
+		}
+		if !isWord(ta[i]) || !isWord(tb[i]) {
+			return false
+		}
+		edits += levenshtein(ta[i], tb[i])
+	}
+	return edits <= typoDistance(a, b)
+}
+
+// isWord checks if a token is a run of at least two letters.
+func isWord(token string) bool {
+	r, size := utf8.DecodeRuneInString(token)
+	return unicode.IsLetter(r) && size < len(token)
+}
+
+// levenshtein is the number of single rune edits needed to turn a into b.
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
+
+// clusterLabels groups labels whose normalized names are equal or typos of
+// each other. Names are taken by usage, most used first, and each joins the
+// first cluster whose most used name it is a typo of. Typo merges are not
+// transitive, so a chain of names each one edit apart does not collapse into
+// one cluster.
+func clusterLabels(labels []*LabelUsage) []*LabelCluster {
+	var names []string
+	byName := map[string][]*LabelUsage{}
+	uses := map[string]int{}
+	for _, label := range labels {
+		name := normalizeLabel(label.Name)
+		if _, ok := byName[name]; !ok {
+			names = append(names, name)
+		}
+		byName[name] = append(byName[name], label)
+		uses[name] += label.Uses()
+	}
+	slices.SortFunc(names, func(a, b string) int {
+		if c := cmp.Compare(uses[b], uses[a]); c != 0 {
+			return c
+		}
+		return strings.Compare(a, b)
+	})
+
+	var seeds []string
+	var clusters []*LabelCluster
+	for _, name := range names {
+		i := slices.IndexFunc(seeds, func(seed string) bool { return isTypo(seed, name) })
+		if i < 0 {
+			i = len(clusters)
+			seeds = append(seeds, name)
+			clusters = append(clusters, &LabelCluster{})
+		}
+		clusters[i].Labels = append(clusters[i].Labels, byName[name]...)
+	}
+
+	for _, cluster := range clusters {
+		cluster.suggest()
+	}
+	slices.SortStableFunc(clusters, func(a, b *LabelCluster) int {
+		if c := cmp.Compare(b.Uses(), a.Uses()); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Name, b.Name)
+	})
+	return clusters
+}
+
+// suggest picks the name of the cluster from its most used variant, breaking
+// ties by the number of repositories with it, then picks the color and
+// description from the labels with that name.
+func (c *LabelCluster) suggest() {
+	uses := map[string]int{}
+	repos := map[string]int{}
+	for _, label := range c.Labels {
+		if _, ok := uses[label.Name]; !ok {
+			c.Variants = append(c.Variants, label.Name)
+		}
+		uses[label.Name] += label.Uses()
+		repos[label.Name]++
+	}
+	slices.Sort(c.Variants)
+
+	c.Name = slices.MaxFunc(c.Variants, func(a, b string) int {
+		if n := cmp.Compare(uses[a], uses[b]); n != 0 {
+			return n
+		}
+		if n := cmp.Compare(repos[a], repos[b]); n != 0 {
+			return n
+		}
+		// prefer the alphabetically first name
+		return strings.Compare(b, a)
+	})
+
+	slices.SortStableFunc(c.Labels, func(a, b *LabelUsage) int {
+		if n := strings.Compare(a.Name, b.Name); n != 0 {
+			return n
+		}
+		return strings.Compare(a.Repo, b.Repo)
+	})
+	// The color is the one most used by labels with the name
+	colors := map[string]int{}
+	for _, label := range c.Labels {
+		if label.Name != c.Name {
+			continue
+		}
+		colors[label.Color]++
+		if colors[label.Color] > colors[c.Color] {
+			c.Color = label.Color
+		}
+		if c.Description == "" {
+			c.Description = label.Description
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package github
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestNormalizeLabel(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"bug", "bug"},
+		{"Good First Issue", "good first issue"},
+		{"good-first-issue", "good first issue"},
+		{"good_first__issue", "good first issue"},
+		{"  needs   review ", "needs review"},
+		{"size/S", "size/s"},
+		{"2.7.x", "2.7.x"},
+	}
+	for _, tt := range tests {
+		if got := normalizeLabel(tt.name); got != tt.want {
+			t.Errorf("normalizeLabel(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestLevenshtein(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"", "bug", 3},
+		{"bug", "bug", 0},
+		{"bug", "bugs", 1},
+		{"enhancement", "enhancment", 1},
+		{"documentation", "documantation", 1},
+		{"kitten", "sitting", 3},
+		{"änderung", "anderung", 1},
+	}
+	for _, tt := range tests {
+		if got := levenshtein(tt.a, tt.b); got != tt.want {
+			t.Errorf("levenshtein(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+		if got := levenshtein(tt.b, tt.a); got != tt.want {
+			t.Errorf("levenshtein(%q, %q) = %d, want %d", tt.b, tt.a, got, tt.want)
+		}
+	}
+}
+
+func TestClusterLabels(t *testing.T) {
+	label := func(name string, uses int) *LabelUsage {
+		return &LabelUsage{Repo: "repo", Name: name, Color: "ffffff", PullRequests: uses}
+	}
+
+	tests := []struct {
+		name   string
+		labels []*LabelUsage
+		want   [][]string
+	}{
+		{
+			name:   "case and separators",
+			labels: []*LabelUsage{label("Good First Issue", 3), label("good-first-issue", 2), label("good_first_issue", 1)},
+			want:   [][]string{{"Good First Issue", "good-first-issue", "good_first_issue"}},
+		},
+		{
+			name:   "typo in a word",
+			labels: []*LabelUsage{label("enhancement", 5), label("enhancment", 1)},
+			want:   [][]string{{"enhancement", "enhancment"}},
+		},
+		{
+			name:   "short names allow no typos",
+			labels: []*LabelUsage{label("bug", 5), label("bag", 1)},
+			want:   [][]string{{"bug"}, {"bag"}},
+		},
+		{
+			name:   "differing digit",
+			labels: []*LabelUsage{label("tier 1", 5), label("tier 2", 1)},
+			want:   [][]string{{"tier 1"}, {"tier 2"}},
+		},
+		{
+			name:   "differing single letter token",
+			labels: []*LabelUsage{label("size/s", 5), label("size/m", 1)},
+			want:   [][]string{{"size/s"}, {"size/m"}},
+		},
+		{
+			name:   "differing version",
+			labels: []*LabelUsage{label("2.7.x", 5), label("2.8.x", 1)},
+			want:   [][]string{{"2.7.x"}, {"2.8.x"}},
+		},
+		{
+			name:   "typo merges are not transitive",
+			labels: []*LabelUsage{label("blocker", 5), label("blocked", 3), label("locked", 1)},
+			want:   [][]string{{"blocked", "blocker"}, {"locked"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got [][]string
+			for _, cluster := range clusterLabels(tt.labels) {
+				got = append(got, cluster.Variants)
+			}
+			if !slices.EqualFunc(got, tt.want, slices.Equal) {
+				t.Errorf("got clusters %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
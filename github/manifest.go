@@ -0,0 +1,228 @@
+package github
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/google/go-github/v67/github"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+
+	"github.com/serenibyss/nhprtracker/auth"
+)
+
+// LabelSpec is a label every repository should have.
+type LabelSpec struct {
+	Name string `json:"name" yaml:"name"`
+
+	// Color and Description are left as they are on existing labels if
+	// empty.
+	Color       string `json:"color,omitempty" yaml:"color,omitempty"`
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+
+	// Aliases are old names of the label, renamed to Name when found.
+	Aliases []string `json:"aliases,omitempty" yaml:"aliases,omitempty"`
+}
+
+// LabelManifest is the layout of a labels manifest.
+type LabelManifest struct {
+	Labels []*LabelSpec `json:"labels" yaml:"labels"`
+}
+
+// LoadLabelManifest reads a labels manifest from a YAML or JSON file.
+func LoadLabelManifest(file string) (*LabelManifest, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read labels manifest: %w", err)
+	}
+
+	var manifest LabelManifest
+	if err := yaml.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse labels manifest %s: %w", file, err)
+	}
+	if len(manifest.Labels) == 0 {
+		return nil, fmt.Errorf("no labels in %s", file)
+	}
+
+	// Label names are case insensitive on GitHub, so no two names or aliases
+	// may only differ in case
+	seen := map[string]string{}
+	for i, spec := range manifest.Labels {
+		if spec.Name == "" {
+			return nil, fmt.Errorf("label %d in %s needs a name", i+1, file)
+		}
+		for _, name := range append([]string{spec.Name}, spec.Aliases...) {
+			key := strings.ToLower(name)
+			if other, ok := seen[key]; ok {
+				return nil, fmt.Errorf("label name %s in %s is already used by label %s", name, file, other)
+			}
+			seen[key] = spec.Name
+		}
+	}
+	return &manifest, nil
+}
+
+// WriteLabelManifest writes a labels manifest to a YAML file.
+func WriteLabelManifest(file string, manifest *LabelManifest) error {
+	data, err := yaml.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(file, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write labels manifest: %w", err)
+	}
+	return nil
+}
+
+// PlanLabelSync plans reconciling the labels of the repositories with the
+// manifest: missing labels are created, aliased labels renamed, and colors
+// and descriptions fixed. With prune, labels not in the manifest are deleted.
+func PlanLabelSync(client *auth.GithubClient, repos []*github.Repository, manifest *LabelManifest, prune bool) (*Plan, error) {
+	changes := make([][]*Change, len(repos))
+	errs := forEach(client, len(repos), func(i int) error {
+		var err error
+		changes[i], err = planLabelSyncOnRepository(client, repos[i].GetName(), manifest, prune)
+		return err
+	})
+	if err := client.Ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	plan := &Plan{}
+	var hadError bool
+	for i, repo := range repos {
+		if errs[i] != nil {
+			zap.S().Named("github").Errorf("failed to check labels for %s/%s: %v", client.Org, repo.GetName(), errs[i])
+			hadError = true
+			continue
+		}
+		for _, change := range changes[i] {
+			plan.add(change)
+		}
+	}
+	plan.sort()
+
+	if hadError {
+		return plan, errors.New("some repos could not have their labels checked, see logs above")
+	}
+	return plan, nil
+}
+
+func planLabelSyncOnRepository(client *auth.GithubClient, repoName string, manifest *LabelManifest, prune bool) ([]*Change, error) {
+	labels, err := listLabels(client, repoName)
+	if err != nil {
+		return nil, err
+	}
+
+	existing := map[string]*github.Label{}
+	for _, label := range labels {
+		existing[strings.ToLower(label.GetName())] = label
+	}
+
+	var changes []*Change
+	kept := map[string]bool{}
+	for _, spec := range manifest.Labels {
+		// The label is the one with the name, or else the first alias found
+		var label *github.Label
+		action := "update-label"
+		for _, name := range append([]string{spec.Name}, spec.Aliases...) {
+			found, ok := existing[strings.ToLower(name)]
+			if !ok {
+				continue
+			}
+			kept[strings.ToLower(found.GetName())] = true
+			if label != nil {
+				// Only one label can take the name, the others are left for
+				// a merge
+				zap.S().Named("github").Warnf("label %s on repo %s/%s is also an alias of %s, leaving it alone", found.GetName(), client.Org, repoName, spec.Name)
+				continue
+			}
+			label = found
+			if name != spec.Name {
+				action = "rename-label"
+			}
+		}
+
+		if label == nil {
+			changes = append(changes, createLabelChange(repoName, spec.Name, spec.Color, spec.Description))
+			continue
+		}
+		change := editLabelChange(repoName, action, label, spec.Name, spec.Color, spec.Description)
+		if len(change.Fields) == 0 {
+			continue
+		}
+		if len(change.Fields) == 1 && change.Fields[0].Field == "color" {
+			change.Action = "recolor-label"
+		}
+		changes = append(changes, change)
+	}
+
+	if prune {
+		for _, label := range labels {
+			if !kept[strings.ToLower(label.GetName())] {
+				changes = append(changes, deleteLabelChange(repoName, label.GetName()))
+			}
+		}
+	}
+	return changes, nil
+}
+
+// listLabels lists every label of the repository.
+func listLabels(client *auth.GithubClient, repoName string) ([]*github.Label, error) {
+	var labels []*github.Label
+	opts := &github.ListOptions{PerPage: 100}
+
+	for {
+		page, resp, err := client.Issues.ListLabels(client.Ctx, client.Org, repoName, opts)
+		if err != nil {
+			return nil, err
+		}
+		labels = append(labels, page...)
+
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+	return labels, nil
+}
+
+// listIssueLabels lists every label of an issue or PR.
+func listIssueLabels(client *auth.GithubClient, repoName string, number int) ([]*github.Label, error) {
+	var labels []*github.Label
+	opts := &github.ListOptions{PerPage: 100}
+
+	for {
+		page, resp, err := client.Issues.ListLabelsByIssue(client.Ctx, client.Org, repoName, number, opts)
+		if err != nil {
+			return nil, err
+		}
+		labels = append(labels, page...)
+
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+	return labels, nil
+}
+
+// deleteLabelChange plans deleting a label, which removes it from every issue
+// and PR.
+func deleteLabelChange(repoName, name string) *Change {
+	return &Change{
+		Repo:   repoName,
+		Target: name,
+		Action: "delete-label",
+		Fields: []FieldChange{{Field: "name", Current: name, Desired: unsetField}},
+		apply: func(client *auth.GithubClient) error {
+			_, err := client.Issues.DeleteLabel(client.Ctx, client.Org, repoName, name)
+			if err == nil {
+				zap.S().Named("github").Infof("deleted label with name %s on repo %s/%s", name, client.Org, repoName)
+			}
+			return err
+		},
+	}
+}
@@ -0,0 +1,142 @@
+package github
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/google/go-github/v67/github"
+)
+
+func TestLoadLabelManifest(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    *LabelManifest
+		wantErr bool
+	}{
+		{
+			name: "yaml",
+			data: "labels:\n  - name: bug\n    color: d73a4a\n  - name: 'type: feature'\n    aliases: [enhancement]\n",
+			want: &LabelManifest{Labels: []*LabelSpec{
+				{Name: "bug", Color: "d73a4a"},
+				{Name: "type: feature", Aliases: []string{"enhancement"}},
+			}},
+		},
+		{
+			name: "json",
+			data: `{"labels": [{"name": "bug", "description": "Something is broken"}]}`,
+			want: &LabelManifest{Labels: []*LabelSpec{{Name: "bug", Description: "Something is broken"}}},
+		},
+		{name: "no labels", data: "labels: []\n", wantErr: true},
+		{name: "label without name", data: "labels:\n  - color: d73a4a\n", wantErr: true},
+		{name: "duplicate name", data: "labels:\n  - name: bug\n  - name: Bug\n", wantErr: true},
+		{name: "alias of other label", data: "labels:\n  - name: bug\n  - name: defect\n    aliases: [BUG]\n", wantErr: true},
+		{name: "malformed", data: "labels: [", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "labels.yaml")
+			if err := os.WriteFile(file, []byte(tt.data), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := LoadLabelManifest(file)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("LoadLabelManifest() = %+v, want error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("LoadLabelManifest() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlanLabelSyncOnRepository(t *testing.T) {
+	manifest := &LabelManifest{Labels: []*LabelSpec{
+		{Name: "bug", Color: "d73a4a"},
+		{Name: "type: enhancement", Color: "A2EEEF", Aliases: []string{"enhancement"}},
+		{Name: "type: feature", Color: "00ff00", Aliases: []string{"feature request", "feature"}},
+		{Name: "documentation", Color: "0075ca", Description: "Improvements to docs"},
+		{Name: "wontfix", Color: "#FFFFFF"},
+	}}
+	existing := []*github.Label{
+		testLabel("bug", "ffffff", "Something is broken"),
+		testLabel("enhancement", "a2eeef", ""),
+		testLabel("Feature Request", "000000", "Asks for something new"),
+		testLabel("feature", "000000", ""),
+		testLabel("wontfix", "ffffff", ""),
+		testLabel("invalid", "e4e669", ""),
+	}
+
+	synced := []Change{
+		{Repo: "repo", Target: "bug", Action: "recolor-label", Fields: []FieldChange{
+			{Field: "color", Current: "ffffff", Desired: "d73a4a"},
+		}},
+		{Repo: "repo", Target: "enhancement", Action: "rename-label", Fields: []FieldChange{
+			{Field: "name", Current: "enhancement", Desired: "type: enhancement"},
+		}},
+		// the first alias found is renamed, the others are left alone
+		{Repo: "repo", Target: "Feature Request", Action: "rename-label", Fields: []FieldChange{
+			{Field: "name", Current: "Feature Request", Desired: "type: feature"},
+			{Field: "color", Current: "000000", Desired: "00ff00"},
+		}},
+		{Repo: "repo", Target: "documentation", Action: "create-label", Fields: []FieldChange{
+			{Field: "name", Current: unsetField, Desired: "documentation"},
+			{Field: "color", Current: unsetField, Desired: "0075ca"},
+			{Field: "description", Current: unsetField, Desired: "Improvements to docs"},
+		}},
+	}
+
+	tests := []struct {
+		name  string
+		prune bool
+		want  []Change
+	}{
+		{name: "sync", want: synced},
+		{name: "prune", prune: true, want: append(synced, Change{
+			Repo: "repo", Target: "invalid", Action: "delete-label", Fields: []FieldChange{
+				{Field: "name", Current: "invalid", Desired: unsetField},
+			},
+		})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newTestClient(t, newFakeLabels(existing...).handler(t))
+
+			changes, err := planLabelSyncOnRepository(client, "repo", manifest, tt.prune)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := plannedChanges(changes...); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("planLabelSyncOnRepository() =\n%+v\nwant\n%+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlanLabelSyncOnRepositoryInSync(t *testing.T) {
+	manifest := &LabelManifest{Labels: []*LabelSpec{
+		{Name: "bug", Color: "#D73A4A", Aliases: []string{"defect"}},
+		{Name: "question"},
+	}}
+	client := newTestClient(t, newFakeLabels(
+		testLabel("bug", "d73a4a", "Something is broken"),
+		testLabel("question", "d876e3", "Further information is requested"),
+	).handler(t))
+
+	changes, err := planLabelSyncOnRepository(client, "repo", manifest, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 0 {
+		t.Errorf("planLabelSyncOnRepository() = %+v, want no changes", plannedChanges(changes...))
+	}
+}
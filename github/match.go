@@ -0,0 +1,229 @@
+package github
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/google/go-github/v67/github"
+	"go.uber.org/zap"
+
+	"github.com/serenibyss/nhprtracker/auth"
+)
+
+// MatchStrategy is a way of recognising a PR on the release branch.
+type MatchStrategy string
+
+const (
+	// MatchNumber finds commits referencing the PR number, as in "Title (#123)".
+	MatchNumber MatchStrategy = "number"
+	// MatchCherryPick finds the PR's commits, or commits cherry-picked from
+	// them with 'git cherry-pick -x'.
+	MatchCherryPick MatchStrategy = "cherry-pick"
+	// MatchPatchID finds commits making the same changes as the PR. It needs
+	// the diff of every release branch commit, so is the most expensive.
+	MatchPatchID MatchStrategy = "patch-id"
+)
+
+// DefaultMatchStrategies are the strategies used unless others are selected.
+var DefaultMatchStrategies = []MatchStrategy{MatchNumber, MatchCherryPick}
+
+// ParseMatchStrategies validates the names of match strategies.
+func ParseMatchStrategies(names []string) ([]MatchStrategy, error) {
+	if len(names) == 0 {
+		return DefaultMatchStrategies, nil
+	}
+
+	var strategies []MatchStrategy
+	for _, name := range names {
+		strategy := MatchStrategy(strings.TrimSpace(name))
+		switch strategy {
+		case MatchNumber, MatchCherryPick, MatchPatchID:
+			if !slices.Contains(strategies, strategy) {
+				strategies = append(strategies, strategy)
+			}
+		default:
+			return nil, fmt.Errorf("unsupported match strategy %s, allowed: '%s', '%s', '%s'", name, MatchNumber, MatchCherryPick, MatchPatchID)
+		}
+	}
+	return strategies, nil
+}
+
+// cherryPickPattern matches the trailer added by 'git cherry-pick -x'.
+var cherryPickPattern = regexp.MustCompile(`\(cherry picked from commit ([0-9a-f]{7,40})\)`)
+
+// releaseBranch holds the commits of a release branch indexed for matching
+// against PRs.
+type releaseBranch struct {
+	commits []*github.Commit
+
+	// shas holds the SHAs of the release branch commits, and every SHA they
+	// reference in cherry-pick trailers.
+	shas []string
+
+	// hasTrailers is set if any commit was cherry-picked with a trailer, so
+	// that PR commits are only fetched when they could match.
+	hasTrailers bool
+
+	// patchIDs maps the patch-id of each commit to its SHA. It is loaded on
+	// first use by containsPatchID.
+	patchIDs map[string]string
+}
+
+func newReleaseBranch(commits []*github.Commit) *releaseBranch {
+	branch := &releaseBranch{commits: commits}
+	for _, commit := range commits {
+		if sha := commit.GetSHA(); sha != "" {
+			branch.shas = append(branch.shas, sha)
+		}
+		for _, match := range cherryPickPattern.FindAllStringSubmatch(commit.GetMessage(), -1) {
+			branch.shas = append(branch.shas, match[1])
+			branch.hasTrailers = true
+		}
+	}
+	return branch
+}
+
+// containsNumber checks for a commit referencing the PR number in its message,
+// as done by squash merges and GitHub's merge commits.
+func (b *releaseBranch) containsNumber(pr *github.PullRequest) bool {
+	ref := fmt.Sprintf("(#%d)", pr.GetNumber())
+	for _, commit := range b.commits {
+		if strings.Contains(commit.GetMessage(), ref) {
+			return true
+		}
+	}
+	return false
+}
+
+// containsSHA checks for a commit that is, or was cherry-picked from, the
+// commit with the passed SHA. Abbreviated SHAs in trailers match by prefix.
+func (b *releaseBranch) containsSHA(sha string) bool {
+	if sha == "" {
+		return false
+	}
+	for _, known := range b.shas {
+		if strings.HasPrefix(sha, known) || strings.HasPrefix(known, sha) {
+			return true
+		}
+	}
+	return false
+}
+
+// containsCherryPick checks for a commit that is, or was cherry-picked from,
+// the PR's merge commit or one of the PR's own commits.
+func (b *releaseBranch) containsCherryPick(client *auth.GithubClient, repo *github.Repository, pr *github.PullRequest) (bool, error) {
+	if b.containsSHA(pr.GetMergeCommitSHA()) {
+		return true, nil
+	}
+	if !b.hasTrailers {
+		return false, nil
+	}
+
+	shas, err := gatherPRCommitSHAs(client, repo, pr)
+	if err != nil {
+		return false, err
+	}
+	for _, sha := range shas {
+		if b.containsSHA(sha) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// containsPatchID checks for a commit making the same changes as the PR,
+// returning the SHA of the matching commit.
+func (b *releaseBranch) containsPatchID(client *auth.GithubClient, repo *github.Repository, pr *github.PullRequest) (string, error) {
+	if b.patchIDs == nil {
+		b.patchIDs = map[string]string{}
+		for _, commit := range b.commits {
+			id, err := commitPatchID(client, repo, commit.GetSHA())
+			if err != nil {
+				b.patchIDs = nil
+				return "", fmt.Errorf("failed to compute patch-id of commit %s: %w", commit.GetSHA(), err)
+			}
+			if id != "" {
+				b.patchIDs[id] = commit.GetSHA()
+			}
+		}
+	}
+	if len(b.patchIDs) == 0 {
+		return "", nil
+	}
+
+	id, err := prPatchID(client, repo, pr)
+	if err != nil || id == "" {
+		return "", err
+	}
+	return b.patchIDs[id], nil
+}
+
+// match checks the release branch for the PR with each strategy in turn,
+// returning the strategy that found it or an empty string.
+func (b *releaseBranch) match(client *auth.GithubClient, repo *github.Repository, pr *github.PullRequest, strategies []MatchStrategy) (MatchStrategy, error) {
+	for _, strategy := range strategies {
+		var found bool
+		var err error
+		switch strategy {
+		case MatchNumber:
+			found = b.containsNumber(pr)
+		case MatchCherryPick:
+			found, err = b.containsCherryPick(client, repo, pr)
+		case MatchPatchID:
+			var sha string
+			sha, err = b.containsPatchID(client, repo, pr)
+			found = sha != ""
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to match PR #%d by %s: %w", pr.GetNumber(), strategy, err)
+		}
+		if found {
+			return strategy, nil
+		}
+	}
+	return "", nil
+}
+
+// filterMatchingPRs returns the PRs that have no matching commit on the
+// release branch, and the strategy that matched each of the others.
+func filterMatchingPRs(client *auth.GithubClient, repo *github.Repository, repoName string, prs []*github.PullRequest, branch *releaseBranch, strategies []MatchStrategy) ([]*github.PullRequest, map[*github.PullRequest]MatchStrategy, error) {
+	var newPrs []*github.PullRequest
+	matched := map[*github.PullRequest]MatchStrategy{}
+	for _, pr := range prs {
+		strategy, err := branch.match(client, repo, pr, strategies)
+		if err != nil {
+			return nil, matched, err
+		}
+		if strategy == "" {
+			newPrs = append(newPrs, pr)
+			continue
+		}
+		zap.S().Named("github").Debugf("found matching release branch commit for PR #%d on repo %s by %s", pr.GetNumber(), repoName, strategy)
+		matched[pr] = strategy
+	}
+	return newPrs, matched, nil
+}
+
+// gatherPRCommitSHAs lists the SHAs of the commits on a PR.
+func gatherPRCommitSHAs(client *auth.GithubClient, repo *github.Repository, pr *github.PullRequest) ([]string, error) {
+	var shas []string
+	opts := &github.ListOptions{PerPage: 100}
+
+	for {
+		commits, resp, err := client.PullRequests.ListCommits(client.Ctx, client.Org, repo.GetName(), pr.GetNumber(), opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, commit := range commits {
+			shas = append(shas, commit.GetSHA())
+		}
+
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+	return shas, nil
+}
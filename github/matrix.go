@@ -0,0 +1,184 @@
+package github
+
+import (
+	"errors"
+	"slices"
+
+	"github.com/google/go-github/v67/github"
+	"go.uber.org/zap"
+
+	"github.com/serenibyss/nhprtracker/auth"
+)
+
+// BranchState is the state of a merged PR on a single release branch.
+type BranchState string
+
+// States a merged PR can be in on a release branch.
+const (
+	// StateContained means the PR was found on the release branch.
+	StateContained BranchState = "contained"
+
+	// StateMissing means the PR was not found on the release branch.
+	StateMissing BranchState = "missing"
+
+	// StateNoReleaseBranch means the repository of the PR does not have the
+	// release branch, so the PR is reported as missing from it.
+	StateNoReleaseBranch BranchState = "no-release-branch"
+
+	// StateNotIntended means the label policy did not select the PR for the
+	// release branch.
+	StateNotIntended BranchState = "not-intended"
+)
+
+// Reported checks if PRs in this state are reported as missing from the
+// release branch.
+func (s BranchState) Reported() bool {
+	return s == StateMissing || s == StateNoReleaseBranch
+}
+
+// BranchMatrix records the state of merged PRs on each release branch.
+type BranchMatrix struct {
+	// Branches holds the release branches checked, in alphabetical order.
+	Branches []string
+
+	// States maps each PR to its state on each release branch.
+	States map[*github.PullRequest]map[string]BranchState
+
+	// Matches maps each PR to the strategy that found it on each release
+	// branch containing it.
+	Matches map[*github.PullRequest]map[string]MatchStrategy
+}
+
+// State returns the state of the PR on the passed release branch, or an
+// empty string if it was not checked.
+func (m *BranchMatrix) State(pr *github.PullRequest, branch string) BranchState {
+	if m == nil {
+		return ""
+	}
+	return m.States[pr][branch]
+}
+
+// MatchedBy returns the strategy that found the PR on the passed release
+// branch, or an empty string if it is not contained in the branch.
+func (m *BranchMatrix) MatchedBy(pr *github.PullRequest, branch string) MatchStrategy {
+	if m == nil {
+		return ""
+	}
+	return m.Matches[pr][branch]
+}
+
+// Reported checks if the PR is reported as missing from any release branch.
+func (m *BranchMatrix) Reported(pr *github.PullRequest) bool {
+	if m == nil {
+		return false
+	}
+	for _, branch := range m.Branches {
+		if m.State(pr, branch).Reported() {
+			return true
+		}
+	}
+	return false
+}
+
+// MissingOn returns the PRs of the map that were not found on the passed
+// release branch of their repository. PRs whose repository lacks the branch
+// are left out, as there is nothing to compare them with.
+func (m *BranchMatrix) MissingOn(branch string, prMap map[string][]*github.PullRequest) map[string][]*github.PullRequest {
+	newPrMap := map[string][]*github.PullRequest{}
+	for repoName, prs := range prMap {
+		for _, pr := range prs {
+			if m.State(pr, branch) == StateMissing {
+				newPrMap[repoName] = append(newPrMap[repoName], pr)
+			}
+		}
+	}
+	return newPrMap
+}
+
+// BuildBranchMatrix checks the merged PRs against each release branch of the
+// client, returning their state per branch together with the PRs reported as
+// missing from at least one branch.
+func BuildBranchMatrix(client *auth.GithubClient, repos []*github.Repository, prMap map[string][]*github.PullRequest, policy *LabelPolicy, strategies []MatchStrategy) (*BranchMatrix, map[string][]*github.PullRequest, error) {
+	branches, err := ResolveReleaseBranches(client, repos)
+	if len(branches) == 0 {
+		return nil, nil, err
+	}
+
+	var errs []error
+	if err != nil {
+		zap.S().Error(err)
+		errs = append(errs, err)
+	}
+
+	matrix := &BranchMatrix{
+		Branches: branches,
+		States:   map[*github.PullRequest]map[string]BranchState{},
+		Matches:  map[*github.PullRequest]map[string]MatchStrategy{},
+	}
+	for _, prs := range prMap {
+		for _, pr := range prs {
+			matrix.States[pr] = map[string]BranchState{}
+			matrix.Matches[pr] = map[string]MatchStrategy{}
+		}
+	}
+
+	for _, branch := range branches {
+		branchClient := client.WithBranch(branch)
+
+		// Gather repositories with the release branch to compare with
+		releaseRepos, err := GatherReleaseRepositories(branchClient, repos)
+		if err != nil {
+			if ctxErr := client.Ctx.Err(); ctxErr != nil {
+				return nil, nil, ctxErr
+			}
+			zap.S().Error(err)
+			errs = append(errs, err)
+		}
+
+		// Only compare PRs intended for the release branch
+		intended := ApplyLabelPolicy(prMap, policy, branch)
+
+		missing, matched, err := FilterMatchingCommitsOnBranch(branchClient, intended, releaseRepos, strategies)
+		if err != nil {
+			if ctxErr := client.Ctx.Err(); ctxErr != nil {
+				return nil, nil, ctxErr
+			}
+			zap.S().Error(err)
+			errs = append(errs, err)
+		}
+
+		for repoName, prs := range prMap {
+			for _, pr := range prs {
+				var state BranchState
+				switch {
+				case !slices.Contains(intended[repoName], pr):
+					state = StateNotIntended
+				case releaseRepos[repoName] == nil:
+					state = StateNoReleaseBranch
+				case slices.Contains(missing[repoName], pr):
+					state = StateMissing
+				default:
+					state = StateContained
+					if strategy, ok := matched[pr]; ok {
+						matrix.Matches[pr][branch] = strategy
+					}
+				}
+				matrix.States[pr][branch] = state
+			}
+		}
+	}
+
+	reported := map[string][]*github.PullRequest{}
+	for repoName, prs := range prMap {
+		for _, pr := range prs {
+			if matrix.Reported(pr) {
+				reported[repoName] = append(reported[repoName], pr)
+			}
+		}
+	}
+
+	if len(errs) != 0 {
+		return matrix, reported, errors.New("some release branches could not be checked, see logs above")
+	}
+	return matrix, reported, nil
+}
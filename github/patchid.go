@@ -0,0 +1,104 @@
+package github
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/google/go-github/v67/github"
+
+	"github.com/serenibyss/nhprtracker/auth"
+)
+
+// patchID computes a hash of the changes made to the passed files that is
+// equal for the same change applied on a different base. Like git patch-id it
+// ignores whitespace, line numbers and file order, but it also ignores context
+// lines as those commonly differ between master and a release branch. An
+// empty string is returned if a file's diff is unavailable, as happens for
+// very large files.
+func patchID(files []*github.CommitFile) string {
+	var fileIDs []string
+	for _, file := range files {
+		h := sha256.New()
+		h.Write([]byte(file.GetFilename() + "\n"))
+
+		patch := file.GetPatch()
+		if patch == "" {
+			if file.GetChanges() != 0 {
+				return ""
+			}
+			// binary files and renames have no patch, the blob identifies the change
+			h.Write([]byte(file.GetStatus() + " " + file.GetSHA() + "\n"))
+		}
+
+		for _, line := range strings.Split(patch, "\n") {
+			if !strings.HasPrefix(line, "+") && !strings.HasPrefix(line, "-") {
+				continue
+			}
+			h.Write([]byte(line[:1] + stripSpace(line[1:]) + "\n"))
+		}
+		fileIDs = append(fileIDs, hex.EncodeToString(h.Sum(nil)))
+	}
+	if len(fileIDs) == 0 {
+		return ""
+	}
+
+	slices.Sort(fileIDs)
+	sum := sha256.Sum256([]byte(strings.Join(fileIDs, "\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+func stripSpace(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// prPatchID computes the patch-id of the full diff of a PR.
+func prPatchID(client *auth.GithubClient, repo *github.Repository, pr *github.PullRequest) (string, error) {
+	var allFiles []*github.CommitFile
+	opts := &github.ListOptions{PerPage: 100}
+
+	for {
+		files, resp, err := client.PullRequests.ListFiles(client.Ctx, client.Org, repo.GetName(), pr.GetNumber(), opts)
+		if err != nil {
+			return "", err
+		}
+		allFiles = append(allFiles, files...)
+
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+	return patchID(allFiles), nil
+}
+
+// commitPatchID computes the patch-id of a single commit.
+func commitPatchID(client *auth.GithubClient, repo *github.Repository, sha string) (string, error) {
+	var allFiles []*github.CommitFile
+	opts := &github.ListOptions{PerPage: 100}
+
+	for {
+		commit, resp, err := client.Repositories.GetCommit(client.Ctx, client.Org, repo.GetName(), sha, opts)
+		if err != nil {
+			return "", err
+		}
+		// merge commits have no single diff to compare against
+		if len(commit.Parents) > 1 {
+			return "", nil
+		}
+		allFiles = append(allFiles, commit.Files...)
+
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+	return patchID(allFiles), nil
+}
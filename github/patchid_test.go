@@ -0,0 +1,102 @@
+package github
+
+import (
+	"testing"
+
+	"github.com/google/go-github/v67/github"
+)
+
+func TestPatchID(t *testing.T) {
+	file := func(name, patch string) *github.CommitFile {
+		return &github.CommitFile{Filename: github.String(name), Patch: github.String(patch), Changes: github.Int(1)}
+	}
+
+	const hunk = `@@ -10,7 +10,7 @@ public class Recipes {
+     public void register() {
+         addShaped(output, inputs);
+-        addShapeless(output, inputs);
++        addShapeless(output, inputs, true);
+     }
+ }`
+	base := []*github.CommitFile{file("src/Recipes.java", hunk), file("src/Items.java", "@@ -1 +1 @@\n-a\n+b")}
+
+	tests := []struct {
+		name  string
+		files []*github.CommitFile
+		equal bool
+	}{
+		{
+			name:  "same hunk",
+			files: []*github.CommitFile{file("src/Recipes.java", hunk), file("src/Items.java", "@@ -1 +1 @@\n-a\n+b")},
+			equal: true,
+		},
+		{
+			name: "different context and line numbers",
+			files: []*github.CommitFile{file("src/Recipes.java", `@@ -42,6 +42,6 @@ public class Recipes {
+         addShaped(other, inputs);
+-        addShapeless(output, inputs);
++        addShapeless(output, inputs, true);
+     }`), file("src/Items.java", "@@ -7 +7 @@\n-a\n+b")},
+			equal: true,
+		},
+		{
+			name: "different whitespace",
+			files: []*github.CommitFile{file("src/Recipes.java", `@@ -10,7 +10,7 @@
+-	addShapeless(output,inputs);
++	addShapeless( output, inputs, true );`), file("src/Items.java", "@@ -1 +1 @@\n- a\n+b ")},
+			equal: true,
+		},
+		{
+			name:  "different file order",
+			files: []*github.CommitFile{base[1], base[0]},
+			equal: true,
+		},
+		{
+			name: "different hunk",
+			files: []*github.CommitFile{file("src/Recipes.java", `@@ -10,7 +10,7 @@
+-        addShapeless(output, inputs);
++        addShapeless(output, inputs, false);`), base[1]},
+			equal: false,
+		},
+		{
+			name:  "different file",
+			files: []*github.CommitFile{file("src/Other.java", hunk), base[1]},
+			equal: false,
+		},
+		{
+			name:  "missing file",
+			files: []*github.CommitFile{base[0]},
+			equal: false,
+		},
+	}
+	want := patchID(base)
+	if want == "" {
+		t.Fatal("patchID of base files is empty")
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := patchID(tt.files); (got == want) != tt.equal {
+				t.Errorf("patchID equal = %v, want %v", got == want, tt.equal)
+			}
+		})
+	}
+}
+
+func TestPatchIDUnavailable(t *testing.T) {
+	tests := []struct {
+		name  string
+		files []*github.CommitFile
+		want  bool
+	}{
+		{name: "no files", files: nil, want: false},
+		{name: "truncated diff", files: []*github.CommitFile{{Filename: github.String("big.json"), Changes: github.Int(5000)}}, want: false},
+		{name: "binary file", files: []*github.CommitFile{{Filename: github.String("icon.png"), Status: github.String("added"), SHA: github.String("abc")}}, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := patchID(tt.files) != ""; got != tt.want {
+				t.Errorf("patchID available = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
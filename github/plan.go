@@ -0,0 +1,86 @@
+package github
+
+import (
+	"errors"
+	"slices"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/serenibyss/nhprtracker/auth"
+)
+
+// FieldChange is a field modified by a planned change.
+type FieldChange struct {
+	Field   string `json:"field"`
+	Current string `json:"current"`
+	Desired string `json:"desired"`
+}
+
+// Change is a modification planned on a repository.
+type Change struct {
+	// Repo is the repository changed, or empty for changes to the
+	// organization.
+	Repo string `json:"repo"`
+
+	// Target is the branch or label that is changed.
+	Target string `json:"target"`
+
+	// Action describes the change, like "protect" or "create-label".
+	Action string        `json:"action"`
+	Fields []FieldChange `json:"fields,omitempty"`
+
+	apply func(client *auth.GithubClient) error
+}
+
+// Plan holds changes computed without modifying any repository, so they can
+// be reviewed before they are applied.
+type Plan struct {
+	Changes []*Change
+}
+
+// add appends a change to the plan.
+func (p *Plan) add(change *Change) {
+	p.Changes = append(p.Changes, change)
+}
+
+// sort orders the changes by repository, then by target.
+func (p *Plan) sort() {
+	slices.SortStableFunc(p.Changes, func(a, b *Change) int {
+		if c := strings.Compare(a.Repo, b.Repo); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Target, b.Target)
+	})
+}
+
+// Apply makes the planned changes, returning the changes that succeeded.
+// Failed changes are logged and do not stop the others.
+func (p *Plan) Apply(client *auth.GithubClient) ([]*Change, error) {
+	errs := forEach(client, len(p.Changes), func(i int) error {
+		return p.Changes[i].apply(client)
+	})
+	if err := client.Ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var applied []*Change
+	var hadError bool
+	for i, change := range p.Changes {
+		if errs[i] != nil {
+			if change.Repo == "" {
+				zap.S().Named("github").Errorf("failed to %s %s on organization %s: %v", change.Action, change.Target, client.Org, errs[i])
+			} else {
+				zap.S().Named("github").Errorf("failed to %s %s on repo %s/%s: %v", change.Action, change.Target, client.Org, change.Repo, errs[i])
+			}
+			hadError = true
+			continue
+		}
+		applied = append(applied, change)
+	}
+
+	if hadError {
+		return applied, errors.New("some changes could not be applied, see logs above")
+	}
+	return applied, nil
+}
@@ -0,0 +1,101 @@
+package github
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/google/go-github/v67/github"
+	"go.uber.org/zap"
+)
+
+// LabelPolicy selects the merged PRs that are intended for a release branch
+// based on their labels. Labels are compared case-insensitively.
+type LabelPolicy struct {
+	// Require lists labels of which a PR must carry at least one. An empty
+	// list accepts every PR.
+	Require []string
+
+	// Exclude lists labels that remove a PR regardless of its other labels.
+	Exclude []string
+
+	// Branches maps labels to the release branches PRs carrying them are
+	// intended for. PRs without any mapped label are intended for every
+	// release branch.
+	Branches map[string][]string
+}
+
+// ParseBranchLabels parses 'LABEL=BRANCH' mappings of labels to the release
+// branches they target. A label may be mapped to several branches.
+func ParseBranchLabels(mappings []string) (map[string][]string, error) {
+	branches := map[string][]string{}
+	for _, mapping := range mappings {
+		label, branch, ok := strings.Cut(mapping, "=")
+		label, branch = strings.TrimSpace(label), strings.TrimSpace(branch)
+		if !ok || label == "" || branch == "" {
+			return nil, fmt.Errorf("branch label mapping %q malformed, must be in LABEL=BRANCH format", mapping)
+		}
+		branches[label] = append(branches[label], branch)
+	}
+	return branches, nil
+}
+
+// hasLabel checks if the PR carries any of the passed labels.
+func hasLabel(pr *github.PullRequest, labels []string) bool {
+	for _, label := range pr.Labels {
+		if slices.ContainsFunc(labels, func(l string) bool {
+			return strings.EqualFold(l, label.GetName())
+		}) {
+			return true
+		}
+	}
+	return false
+}
+
+// Allows checks if the policy selects the PR for the passed release branch.
+func (p *LabelPolicy) Allows(pr *github.PullRequest, branch string) bool {
+	if hasLabel(pr, p.Exclude) {
+		return false
+	}
+	if len(p.Require) != 0 && !hasLabel(pr, p.Require) {
+		return false
+	}
+
+	var targeted bool
+	for label, branches := range p.Branches {
+		if !hasLabel(pr, []string{label}) {
+			continue
+		}
+		if slices.Contains(branches, branch) {
+			return true
+		}
+		targeted = true
+	}
+	return !targeted
+}
+
+// ApplyLabelPolicy returns the PRs the policy selects for the passed release
+// branch.
+func ApplyLabelPolicy(prMap map[string][]*github.PullRequest, policy *LabelPolicy, branch string) map[string][]*github.PullRequest {
+	newPrMap := map[string][]*github.PullRequest{}
+	var filtered int
+	for repoName, prs := range prMap {
+		var kept []*github.PullRequest
+		for _, pr := range prs {
+			if !policy.Allows(pr, branch) {
+				zap.S().Named("github").Debugf("label policy excluded PR #%d on repo %s", pr.GetNumber(), repoName)
+				filtered++
+				continue
+			}
+			kept = append(kept, pr)
+		}
+		if len(kept) != 0 {
+			newPrMap[repoName] = kept
+		}
+	}
+
+	if filtered != 0 {
+		zap.S().Named("github").Infof("label policy excluded %d PRs not intended for %s", filtered, branch)
+	}
+	return newPrMap
+}
@@ -0,0 +1,77 @@
+package github
+
+import (
+	"testing"
+
+	"github.com/google/go-github/v67/github"
+)
+
+func TestLabelPolicyAllows(t *testing.T) {
+	pr := func(labels ...string) *github.PullRequest {
+		pr := &github.PullRequest{}
+		for _, label := range labels {
+			pr.Labels = append(pr.Labels, &github.Label{Name: github.String(label)})
+		}
+		return pr
+	}
+	policy := &LabelPolicy{
+		Require: []string{"backport", "bugfix"},
+		Exclude: []string{"no-backport"},
+		Branches: map[string][]string{
+			"2.7.x":  {"release/2.7.x"},
+			"stable": {"release/2.7.x", "release/2.8.x"},
+		},
+	}
+
+	tests := []struct {
+		name   string
+		pr     *github.PullRequest
+		branch string
+		want   bool
+	}{
+		{name: "required label", pr: pr("backport"), branch: "release/2.8.x", want: true},
+		{name: "any required label", pr: pr("bugfix"), branch: "release/2.8.x", want: true},
+		{name: "no required label", pr: pr("enhancement"), branch: "release/2.8.x", want: false},
+		{name: "no labels", pr: pr(), branch: "release/2.8.x", want: false},
+		{name: "exclude wins over require", pr: pr("backport", "no-backport"), branch: "release/2.8.x", want: false},
+		{name: "exclude wins over branch label", pr: pr("backport", "2.7.x", "No-Backport"), branch: "release/2.7.x", want: false},
+		{name: "require case-insensitive", pr: pr("BackPort"), branch: "release/2.8.x", want: true},
+		{name: "exclude case-insensitive", pr: pr("backport", "NO-BACKPORT"), branch: "release/2.8.x", want: false},
+		{name: "branch label targets its branch", pr: pr("backport", "2.7.x"), branch: "release/2.7.x", want: true},
+		{name: "branch label skips other branches", pr: pr("backport", "2.7.x"), branch: "release/2.8.x", want: false},
+		{name: "branch label case-insensitive", pr: pr("backport", "2.7.X"), branch: "release/2.8.x", want: false},
+		{name: "label mapped to several branches", pr: pr("backport", "stable"), branch: "release/2.8.x", want: true},
+		{name: "any branch label targets", pr: pr("backport", "2.7.x", "stable"), branch: "release/2.8.x", want: true},
+		{name: "branch label still needs required label", pr: pr("2.7.x"), branch: "release/2.7.x", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := policy.Allows(tt.pr, tt.branch); got != tt.want {
+				t.Errorf("Allows(%s) = %v, want %v", tt.branch, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLabelPolicyEmptyAllowsAll(t *testing.T) {
+	pr := &github.PullRequest{Labels: []*github.Label{{Name: github.String("anything")}}}
+	if !(&LabelPolicy{}).Allows(pr, "release/2.7.x") || !(&LabelPolicy{}).Allows(&github.PullRequest{}, "release/2.7.x") {
+		t.Error("empty policy rejected a PR")
+	}
+}
+
+func TestParseBranchLabels(t *testing.T) {
+	got, err := ParseBranchLabels([]string{"2.7.x=release/2.7.x", " stable = release/2.7.x", "stable=release/2.8.x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || len(got["2.7.x"]) != 1 || len(got["stable"]) != 2 || got["stable"][1] != "release/2.8.x" {
+		t.Errorf("got %v", got)
+	}
+
+	for _, mapping := range []string{"2.7.x", "=release/2.7.x", "2.7.x=", " = "} {
+		if _, err := ParseBranchLabels([]string{mapping}); err == nil {
+			t.Errorf("ParseBranchLabels(%q) succeeded, want error", mapping)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package github
+
+import (
+	"sync"
+
+	"github.com/serenibyss/nhprtracker/auth"
+)
+
+// forEach calls fn for every index in [0, n) using up to client.Concurrency
+// goroutines, and returns the error of each call at the same index. Calls not
+// yet started when client.Ctx is cancelled are skipped and fail with the
+// context's error. Callers that store results by index get the same ordering
+// regardless of the concurrency used.
+func forEach(client *auth.GithubClient, n int, fn func(i int) error) []error {
+	workers := min(max(client.Concurrency, 1), n)
+	errs := make([]error, n)
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				if err := client.Ctx.Err(); err != nil {
+					errs[i] = err
+					continue
+				}
+				errs[i] = fn(i)
+			}
+		}()
+	}
+
+	for i := range n {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	return errs
+}
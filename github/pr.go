@@ -2,29 +2,39 @@ package github
 
 import (
 	"errors"
-	"strings"
 
 	"github.com/google/go-github/v67/github"
 	"go.uber.org/zap"
 
 	"github.com/serenibyss/nhprtracker/auth"
-	"github.com/serenibyss/nhprtracker/internal"
 )
 
-// GatherMergedPRs returns a map of all pull requests merged to specific repos after a specified date.
+// GatherMergedPRs returns a map of all pull requests merged to specific repos within the window of each.
 func GatherMergedPRs(client *auth.GithubClient, repos []*github.Repository) (map[string][]*github.PullRequest, error) {
+	if client.API == auth.APIGraphQL {
+		return gatherMergedPRsGraphQL(client, repos)
+	}
+
 	prMap := make(map[string][]*github.PullRequest)
-	var hadError bool
+	results := make([][]*github.PullRequest, len(repos))
+	errs := forEach(client, len(repos), func(i int) error {
+		var err error
+		results[i], err = gatherMergedPRsForRepo(client, repos[i])
+		return err
+	})
+	if err := client.Ctx.Err(); err != nil {
+		return prMap, err
+	}
 
-	for _, repo := range repos {
-		prs, err := gatherMergedPRsForRepo(client, repo)
-		if err != nil {
-			zap.S().Named("github").Errorf("failed to list pull requests for repo %s/%s: %v", client.Org, repo.GetName(), err)
+	var hadError bool
+	for i, repo := range repos {
+		if errs[i] != nil {
+			zap.S().Named("github").Errorf("failed to list pull requests for repo %s/%s: %v", client.Org, repo.GetName(), errs[i])
 			hadError = true
 		}
-		if prs != nil {
-			zap.S().Named("github").Debugf("found %d PRs for repo %s", len(prs), repo.GetName())
-			prMap[client.Org+"/"+repo.GetName()] = prs
+		if results[i] != nil {
+			zap.S().Named("github").Debugf("found %d PRs for repo %s", len(results[i]), repo.GetName())
+			prMap[client.Org+"/"+repo.GetName()] = results[i]
 		}
 	}
 
@@ -34,10 +44,11 @@ func GatherMergedPRs(client *auth.GithubClient, repos []*github.Repository) (map
 	return prMap, nil
 }
 
-// gatherMergedPRsForRepo gathers all PRs merged before a specified date for a specified repository.
+// gatherMergedPRsForRepo gathers all PRs merged within the window of a specified repository.
 func gatherMergedPRsForRepo(client *auth.GithubClient, repo *github.Repository) ([]*github.PullRequest, error) {
 	var prList []*github.PullRequest
 	repoName := repo.GetName()
+	window := client.Window(repoName)
 	opts := &github.PullRequestListOptions{
 		State:     "closed",
 		Sort:      "updated",
@@ -57,11 +68,15 @@ func gatherMergedPRsForRepo(client *auth.GithubClient, repo *github.Repository)
 				continue
 			}
 
-			if pr.GetMergedAt().Before(client.Date) {
+			if pr.GetMergedAt().Before(window.Start) {
 				return prList, nil
 			}
 
-			if !prTitleCheck(pr) {
+			if !window.Contains(pr.GetMergedAt().Time) {
+				continue
+			}
+
+			if excludePR(client, pr) {
 				continue
 			}
 
@@ -77,11 +92,16 @@ func gatherMergedPRsForRepo(client *auth.GithubClient, repo *github.Repository)
 	return prList, nil
 }
 
-func prTitleCheck(pr *github.PullRequest) bool {
-	for _, excl := range internal.ExcludedPRTitles {
-		if strings.Contains(pr.GetTitle(), excl) {
-			return false
-		}
+// excludePR checks if the PR is left out of reports by the exclusions of the
+// client.
+func excludePR(client *auth.GithubClient, pr *github.PullRequest) bool {
+	var labels []string
+	for _, label := range pr.Labels {
+		labels = append(labels, label.GetName())
+	}
+	if client.Exclusions.ExcludePR(pr.GetTitle(), pr.GetUser().GetLogin(), labels) {
+		zap.S().Debugf("excluded pr #%d (%s) by %s", pr.GetNumber(), pr.GetTitle(), pr.GetUser().GetLogin())
+		return true
 	}
-	return true
+	return false
 }
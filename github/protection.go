@@ -0,0 +1,488 @@
+package github
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-github/v67/github"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+
+	"github.com/serenibyss/nhprtracker/auth"
+)
+
+// ProtectionRule is the branch protection applied to a release branch. Unset
+// fields are left at GitHub's defaults, or at the value of the rule being
+// overridden.
+type ProtectionRule struct {
+	// RequiredApprovals requires changes to go through a PR with at least
+	// this many approvals. PRs are not required if unset.
+	RequiredApprovals *int `json:"required_approvals,omitempty" yaml:"required_approvals,omitempty"`
+
+	RequireCodeOwnerReviews *bool `json:"require_code_owner_reviews,omitempty" yaml:"require_code_owner_reviews,omitempty"`
+	DismissStaleReviews     *bool `json:"dismiss_stale_reviews,omitempty" yaml:"dismiss_stale_reviews,omitempty"`
+
+	// RequiredChecks lists the status checks that must pass before merging.
+	RequiredChecks *[]string `json:"required_checks,omitempty" yaml:"required_checks,omitempty"`
+
+	// StrictChecks requires branches to be up to date before merging.
+	StrictChecks *bool `json:"strict_checks,omitempty" yaml:"strict_checks,omitempty"`
+
+	RequireConversationResolution *bool `json:"require_conversation_resolution,omitempty" yaml:"require_conversation_resolution,omitempty"`
+	RequireLinearHistory          *bool `json:"require_linear_history,omitempty" yaml:"require_linear_history,omitempty"`
+	EnforceAdmins                 *bool `json:"enforce_admins,omitempty" yaml:"enforce_admins,omitempty"`
+	AllowForcePushes              *bool `json:"allow_force_pushes,omitempty" yaml:"allow_force_pushes,omitempty"`
+	AllowDeletions                *bool `json:"allow_deletions,omitempty" yaml:"allow_deletions,omitempty"`
+}
+
+// ProtectionOverride replaces fields of a profile's rule for some repositories.
+type ProtectionOverride struct {
+	// Repos holds names or glob patterns of the repositories overridden.
+	Repos []string        `json:"repos" yaml:"repos"`
+	Rule  *ProtectionRule `json:"rule" yaml:"rule"`
+}
+
+// ProtectionProfile is the protection rule of branches matching a pattern.
+type ProtectionProfile struct {
+	// Branches holds names or glob patterns of the branches protected. A
+	// profile without branches applies to every branch.
+	Branches []string        `json:"branches,omitempty" yaml:"branches,omitempty"`
+	Rule     *ProtectionRule `json:"rule" yaml:"rule"`
+
+	// Overrides are applied in order on top of the rule for the
+	// repositories they match.
+	Overrides []*ProtectionOverride `json:"overrides,omitempty" yaml:"overrides,omitempty"`
+}
+
+// protectionProfilesFile is the layout of a protection profiles file.
+type protectionProfilesFile struct {
+	Profiles []*ProtectionProfile `json:"profiles" yaml:"profiles"`
+}
+
+// DefaultProtectionProfiles returns the profiles used when no profiles file
+// is passed: one approval including code owners, a passing build and resolved
+// conversations on every release branch.
+func DefaultProtectionProfiles() []*ProtectionProfile {
+	return []*ProtectionProfile{
+		{
+			Rule: &ProtectionRule{
+				RequiredApprovals:             github.Int(1),
+				RequireCodeOwnerReviews:       github.Bool(true),
+				RequiredChecks:                &[]string{"build-and-test / build-and-test"},
+				RequireConversationResolution: github.Bool(true),
+			},
+		},
+	}
+}
+
+// LoadProtectionProfiles reads protection profiles from a YAML or JSON file.
+func LoadProtectionProfiles(file string) ([]*ProtectionProfile, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read protection profiles: %w", err)
+	}
+
+	var profiles protectionProfilesFile
+	if err := yaml.Unmarshal(data, &profiles); err != nil {
+		return nil, fmt.Errorf("failed to parse protection profiles %s: %w", file, err)
+	}
+	if err := CheckProtectionProfiles(profiles.Profiles, file); err != nil {
+		return nil, err
+	}
+	return profiles.Profiles, nil
+}
+
+// CheckProtectionProfiles validates protection profiles read from source.
+func CheckProtectionProfiles(profiles []*ProtectionProfile, source string) error {
+	if len(profiles) == 0 {
+		return fmt.Errorf("no protection profiles in %s", source)
+	}
+
+	for i, profile := range profiles {
+		if profile.Rule == nil {
+			return fmt.Errorf("protection profile %d in %s needs a rule", i+1, source)
+		}
+		patterns := slices.Clone(profile.Branches)
+		for j, override := range profile.Overrides {
+			if len(override.Repos) == 0 || override.Rule == nil {
+				return fmt.Errorf("override %d of protection profile %d in %s needs repos and a rule", j+1, i+1, source)
+			}
+			patterns = append(patterns, override.Repos...)
+		}
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("pattern %q in protection profile %d malformed: %w", pattern, i+1, err)
+			}
+		}
+	}
+	return nil
+}
+
+// matchesAny checks the name against a list of names or glob patterns.
+func matchesAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// ResolveProtection returns the rule of the first profile matching the branch,
+// with the overrides for the repository applied, or nil if no profile matches.
+func ResolveProtection(profiles []*ProtectionProfile, repoName, branch string) *ProtectionRule {
+	for _, profile := range profiles {
+		if len(profile.Branches) != 0 && !matchesAny(profile.Branches, branch) {
+			continue
+		}
+		rule := *profile.Rule
+		for _, override := range profile.Overrides {
+			if matchesAny(override.Repos, repoName) {
+				rule.apply(override.Rule)
+			}
+		}
+		return &rule
+	}
+	return nil
+}
+
+// apply replaces the fields of the rule that are set in the override.
+func (r *ProtectionRule) apply(override *ProtectionRule) {
+	if override.RequiredApprovals != nil {
+		r.RequiredApprovals = override.RequiredApprovals
+	}
+	if override.RequireCodeOwnerReviews != nil {
+		r.RequireCodeOwnerReviews = override.RequireCodeOwnerReviews
+	}
+	if override.DismissStaleReviews != nil {
+		r.DismissStaleReviews = override.DismissStaleReviews
+	}
+	if override.RequiredChecks != nil {
+		r.RequiredChecks = override.RequiredChecks
+	}
+	if override.StrictChecks != nil {
+		r.StrictChecks = override.StrictChecks
+	}
+	if override.RequireConversationResolution != nil {
+		r.RequireConversationResolution = override.RequireConversationResolution
+	}
+	if override.RequireLinearHistory != nil {
+		r.RequireLinearHistory = override.RequireLinearHistory
+	}
+	if override.EnforceAdmins != nil {
+		r.EnforceAdmins = override.EnforceAdmins
+	}
+	if override.AllowForcePushes != nil {
+		r.AllowForcePushes = override.AllowForcePushes
+	}
+	if override.AllowDeletions != nil {
+		r.AllowDeletions = override.AllowDeletions
+	}
+}
+
+// request converts the rule to a branch protection request. Settings of the
+// existing protection the rule does not model, like push restrictions, review
+// dismissal restrictions and bypass allowances, are carried over, since the
+// request replaces the whole protection of the branch.
+func (r *ProtectionRule) request(existing *github.Protection) *github.ProtectionRequest {
+	req := &github.ProtectionRequest{
+		EnforceAdmins:                  enabled(r.EnforceAdmins),
+		RequiredConversationResolution: r.RequireConversationResolution,
+		RequireLinearHistory:           r.RequireLinearHistory,
+		AllowForcePushes:               r.AllowForcePushes,
+		AllowDeletions:                 r.AllowDeletions,
+	}
+
+	if r.RequiredApprovals != nil {
+		req.RequiredPullRequestReviews = &github.PullRequestReviewsEnforcementRequest{
+			RequiredApprovingReviewCount: *r.RequiredApprovals,
+			RequireCodeOwnerReviews:      enabled(r.RequireCodeOwnerReviews),
+			DismissStaleReviews:          enabled(r.DismissStaleReviews),
+		}
+	}
+
+	if r.RequiredChecks != nil && len(*r.RequiredChecks) != 0 {
+		// Keep the app each existing check is pinned to.
+		apps := map[string]*int64{}
+		if existing != nil && existing.RequiredStatusChecks != nil && existing.RequiredStatusChecks.Checks != nil {
+			for _, check := range *existing.RequiredStatusChecks.Checks {
+				apps[check.Context] = check.AppID
+			}
+		}
+		checks := []*github.RequiredStatusCheck{}
+		for _, check := range *r.RequiredChecks {
+			checks = append(checks, &github.RequiredStatusCheck{Context: check, AppID: apps[check]})
+		}
+		req.RequiredStatusChecks = &github.RequiredStatusChecks{
+			Strict: enabled(r.StrictChecks),
+			Checks: &checks,
+		}
+	}
+
+	if existing == nil {
+		return req
+	}
+	if restrictions := existing.Restrictions; restrictions != nil {
+		req.Restrictions = &github.BranchRestrictionsRequest{
+			Users: userLogins(restrictions.Users),
+			Teams: teamSlugs(restrictions.Teams),
+			Apps:  appSlugs(restrictions.Apps),
+		}
+	}
+	if reviews := existing.RequiredPullRequestReviews; reviews != nil && req.RequiredPullRequestReviews != nil {
+		req.RequiredPullRequestReviews.RequireLastPushApproval = github.Bool(reviews.RequireLastPushApproval)
+		if dismissal := reviews.DismissalRestrictions; dismissal != nil {
+			users, teams, apps := userLogins(dismissal.Users), teamSlugs(dismissal.Teams), appSlugs(dismissal.Apps)
+			req.RequiredPullRequestReviews.DismissalRestrictionsRequest = &github.DismissalRestrictionsRequest{
+				Users: &users,
+				Teams: &teams,
+				Apps:  &apps,
+			}
+		}
+		if bypass := reviews.BypassPullRequestAllowances; bypass != nil {
+			req.RequiredPullRequestReviews.BypassPullRequestAllowancesRequest = &github.BypassPullRequestAllowancesRequest{
+				Users: userLogins(bypass.Users),
+				Teams: teamSlugs(bypass.Teams),
+				Apps:  appSlugs(bypass.Apps),
+			}
+		}
+	}
+	if existing.BlockCreations != nil {
+		req.BlockCreations = existing.BlockCreations.Enabled
+	}
+	if existing.LockBranch != nil {
+		req.LockBranch = existing.LockBranch.Enabled
+	}
+	if existing.AllowForkSyncing != nil {
+		req.AllowForkSyncing = existing.AllowForkSyncing.Enabled
+	}
+	return req
+}
+
+// requiresSignatures checks if the existing protection requires signed
+// commits, which is set apart from the rest of the protection.
+func requiresSignatures(existing *github.Protection) bool {
+	return existing != nil && existing.RequiredSignatures != nil && existing.RequiredSignatures.GetEnabled()
+}
+
+func userLogins(users []*github.User) []string {
+	logins := []string{}
+	for _, user := range users {
+		logins = append(logins, user.GetLogin())
+	}
+	return logins
+}
+
+func teamSlugs(teams []*github.Team) []string {
+	slugs := []string{}
+	for _, team := range teams {
+		slugs = append(slugs, team.GetSlug())
+	}
+	return slugs
+}
+
+func appSlugs(apps []*github.App) []string {
+	slugs := []string{}
+	for _, app := range apps {
+		slugs = append(slugs, app.GetSlug())
+	}
+	return slugs
+}
+
+// protectionFields lists the fields of a rule by their name in profiles.
+var protectionFields = []struct {
+	name  string
+	value func(r *ProtectionRule) string
+}{
+	{"required_approvals", func(r *ProtectionRule) string { return formatInt(r.RequiredApprovals) }},
+	{"require_code_owner_reviews", func(r *ProtectionRule) string { return formatBool(r.RequireCodeOwnerReviews) }},
+	{"dismiss_stale_reviews", func(r *ProtectionRule) string { return formatBool(r.DismissStaleReviews) }},
+	{"required_checks", func(r *ProtectionRule) string { return formatList(r.RequiredChecks) }},
+	{"strict_checks", func(r *ProtectionRule) string { return formatBool(r.StrictChecks) }},
+	{"require_conversation_resolution", func(r *ProtectionRule) string { return formatBool(r.RequireConversationResolution) }},
+	{"require_linear_history", func(r *ProtectionRule) string { return formatBool(r.RequireLinearHistory) }},
+	{"enforce_admins", func(r *ProtectionRule) string { return formatBool(r.EnforceAdmins) }},
+	{"allow_force_pushes", func(r *ProtectionRule) string { return formatBool(r.AllowForcePushes) }},
+	{"allow_deletions", func(r *ProtectionRule) string { return formatBool(r.AllowDeletions) }},
+}
+
+// unsetField is how fields without a value are shown in diffs.
+const unsetField = "unset"
+
+func formatInt(v *int) string {
+	if v == nil {
+		return unsetField
+	}
+	return strconv.Itoa(*v)
+}
+
+func formatBool(v *bool) string {
+	if v == nil {
+		return unsetField
+	}
+	return strconv.FormatBool(*v)
+}
+
+func formatList(v *[]string) string {
+	if v == nil {
+		return unsetField
+	}
+	sorted := slices.Clone(*v)
+	slices.Sort(sorted)
+	return "[" + strings.Join(sorted, ", ") + "]"
+}
+
+// diffProtection compares the fields set in the desired rule with the
+// current rule, returning the fields that differ.
+func diffProtection(current, desired *ProtectionRule) []FieldChange {
+	var changes []FieldChange
+	for _, field := range protectionFields {
+		want := field.value(desired)
+		if want == unsetField {
+			continue
+		}
+		if have := field.value(current); have != want {
+			changes = append(changes, FieldChange{Field: field.name, Current: have, Desired: want})
+		}
+	}
+	return changes
+}
+
+// protectionRuleOf converts the existing protection of a branch to a rule, or
+// returns an empty rule if the branch is not protected.
+func protectionRuleOf(p *github.Protection) *ProtectionRule {
+	rule := &ProtectionRule{}
+	if p == nil {
+		return rule
+	}
+
+	if reviews := p.RequiredPullRequestReviews; reviews != nil {
+		rule.RequiredApprovals = github.Int(reviews.RequiredApprovingReviewCount)
+		rule.RequireCodeOwnerReviews = github.Bool(reviews.RequireCodeOwnerReviews)
+		rule.DismissStaleReviews = github.Bool(reviews.DismissStaleReviews)
+	}
+
+	if checks := p.RequiredStatusChecks; checks != nil {
+		names := []string{}
+		if checks.Checks != nil {
+			for _, check := range *checks.Checks {
+				names = append(names, check.Context)
+			}
+		} else if checks.Contexts != nil {
+			names = append(names, *checks.Contexts...)
+		}
+		rule.RequiredChecks = &names
+		rule.StrictChecks = github.Bool(checks.Strict)
+	} else {
+		rule.RequiredChecks = &[]string{}
+	}
+
+	rule.EnforceAdmins = github.Bool(p.EnforceAdmins != nil && p.EnforceAdmins.Enabled)
+	rule.RequireConversationResolution = github.Bool(p.RequiredConversationResolution != nil && p.RequiredConversationResolution.Enabled)
+	rule.RequireLinearHistory = github.Bool(p.RequireLinearHistory != nil && p.RequireLinearHistory.Enabled)
+	rule.AllowForcePushes = github.Bool(p.AllowForcePushes != nil && p.AllowForcePushes.Enabled)
+	rule.AllowDeletions = github.Bool(p.AllowDeletions != nil && p.AllowDeletions.Enabled)
+	return rule
+}
+
+// ProtectionDrift is how the protection of a release branch differs from its
+// profile.
+type ProtectionDrift struct {
+	Repo      string
+	Branch    string
+	Protected bool
+
+	// Fields holds the fields of the profile the branch does not comply
+	// with. It is empty for compliant branches.
+	Fields []FieldChange
+
+	target     *repoBranch
+	protection *github.Protection
+	current    *ProtectionRule
+	desired    *ProtectionRule
+}
+
+// Compliant checks if the branch protection matches its profile.
+func (d *ProtectionDrift) Compliant() bool {
+	return len(d.Fields) == 0
+}
+
+// AuditBranchRules compares the protection of every branch matching the
+// release branches of the client with the first matching profile, field by
+// field, on all public, unarchived repositories of the organization.
+func AuditBranchRules(client *auth.GithubClient, profiles []*ProtectionProfile) ([]*ProtectionDrift, error) {
+	targets, err := gatherProtectionTargets(client)
+	if err != nil {
+		return nil, err
+	}
+
+	protections := make([]*github.Protection, len(targets))
+	errs := forEach(client, len(targets), func(i int) error {
+		var err error
+		protections[i], err = getProtection(client, targets[i].Repo.GetName(), targets[i].Branch)
+		return err
+	})
+	if err := client.Ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var drifts []*ProtectionDrift
+	var hadError bool
+	for i, target := range targets {
+		repoName := target.Repo.GetName()
+		if errs[i] != nil {
+			zap.S().Named("rules").Errorf("failed to get rule for branch %s on repo %s: %v", target.Branch, repoName, errs[i])
+			hadError = true
+			continue
+		}
+
+		desired := ResolveProtection(profiles, repoName, target.Branch)
+		if desired == nil {
+			zap.S().Named("rules").Warnf("no protection profile matches branch %s on repo %s, skipping", target.Branch, repoName)
+			continue
+		}
+		current := protectionRuleOf(protections[i])
+		drifts = append(drifts, &ProtectionDrift{
+			Repo:       repoName,
+			Branch:     target.Branch,
+			Protected:  protections[i] != nil,
+			Fields:     diffProtection(current, desired),
+			target:     target,
+			protection: protections[i],
+			current:    current,
+			desired:    desired,
+		})
+	}
+	slices.SortFunc(drifts, func(a, b *ProtectionDrift) int {
+		if c := strings.Compare(a.Repo, b.Repo); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Branch, b.Branch)
+	})
+
+	if hadError {
+		return drifts, errors.New("some branch rules could not be checked, see logs above")
+	}
+	return drifts, nil
+}
+
+// PlanEnforcement plans updating the protection of non-compliant branches to
+// match their profile. Fields the profile does not set, and settings it does
+// not model, keep their current value.
+func PlanEnforcement(drifts []*ProtectionDrift) *Plan {
+	plan := &Plan{}
+	for _, drift := range drifts {
+		if drift.Compliant() {
+			continue
+		}
+		enforced := *drift.current
+		enforced.apply(drift.desired)
+		plan.add(protectChange(drift.target, "enforce", drift.protection, drift.current, &enforced))
+	}
+	return plan
+}
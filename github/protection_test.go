@@ -0,0 +1,68 @@
+package github
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/google/go-github/v67/github"
+)
+
+func TestRequestKeepsUnmodelledSettings(t *testing.T) {
+	existing := &github.Protection{
+		RequiredStatusChecks: &github.RequiredStatusChecks{
+			Checks: &[]*github.RequiredStatusCheck{{Context: "build", AppID: github.Int64(15368)}},
+		},
+		RequiredPullRequestReviews: &github.PullRequestReviewsEnforcement{
+			RequiredApprovingReviewCount: 1,
+			RequireLastPushApproval:      true,
+			DismissalRestrictions: &github.DismissalRestrictions{
+				Teams: []*github.Team{{Slug: github.String("maintainers")}},
+			},
+			BypassPullRequestAllowances: &github.BypassPullRequestAllowances{
+				Users: []*github.User{{Login: github.String("release-bot")}},
+			},
+		},
+		Restrictions: &github.BranchRestrictions{
+			Apps: []*github.App{{Slug: github.String("deployer")}},
+		},
+		LockBranch: &github.LockBranch{Enabled: github.Bool(true)},
+	}
+	enforced := *protectionRuleOf(existing)
+	enforced.apply(&ProtectionRule{RequiredApprovals: github.Int(2), RequiredChecks: &[]string{"build", "test"}})
+
+	req := enforced.request(existing)
+	reviews := req.RequiredPullRequestReviews
+	if reviews.RequiredApprovingReviewCount != 2 {
+		t.Errorf("got %d required approvals, want 2", reviews.RequiredApprovingReviewCount)
+	}
+	if !reviews.GetRequireLastPushApproval() {
+		t.Error("require_last_push_approval was dropped")
+	}
+	if reviews.DismissalRestrictionsRequest == nil || !slices.Equal(*reviews.DismissalRestrictionsRequest.Teams, []string{"maintainers"}) {
+		t.Errorf("dismissal restrictions were dropped: %+v", reviews.DismissalRestrictionsRequest)
+	}
+	if reviews.BypassPullRequestAllowancesRequest == nil || !slices.Equal(reviews.BypassPullRequestAllowancesRequest.Users, []string{"release-bot"}) {
+		t.Errorf("bypass allowances were dropped: %+v", reviews.BypassPullRequestAllowancesRequest)
+	}
+	if req.Restrictions == nil || !slices.Equal(req.Restrictions.Apps, []string{"deployer"}) {
+		t.Errorf("push restrictions were dropped: %+v", req.Restrictions)
+	}
+	if !req.GetLockBranch() {
+		t.Error("lock_branch was dropped")
+	}
+
+	checks := *req.RequiredStatusChecks.Checks
+	if len(checks) != 2 || checks[0].GetAppID() != 15368 || checks[1].AppID != nil {
+		t.Errorf("got checks %+v, want build pinned to its app and test unpinned", checks)
+	}
+}
+
+func TestRequestWithoutExistingProtection(t *testing.T) {
+	req := (&ProtectionRule{RequiredApprovals: github.Int(1)}).request(nil)
+	if req.Restrictions != nil {
+		t.Errorf("got restrictions %+v, want none", req.Restrictions)
+	}
+	if req.RequiredPullRequestReviews.DismissalRestrictionsRequest != nil || req.RequiredPullRequestReviews.BypassPullRequestAllowancesRequest != nil {
+		t.Error("got review restrictions for a new protection, want none")
+	}
+}
@@ -2,22 +2,25 @@ package github
 
 import (
 	"errors"
-	"slices"
 
 	"github.com/google/go-github/v67/github"
 	"go.uber.org/zap"
 
 	"github.com/serenibyss/nhprtracker/auth"
-	"github.com/serenibyss/nhprtracker/internal"
 )
 
-// GatherRepositories gathers all repositories on the specified organization
+// GatherRepositories gathers all repositories on the specified organization,
+// resolving the window of each from the since and until tags if set.
 func GatherRepositories(client *auth.GithubClient) ([]*github.Repository, error) {
 	if client.Repos != nil {
-		return gatherSpecificRepositories(client)
+		repos, err := gatherSpecificRepositories(client)
+		if tagErr := resolveTagWindows(client, repos); tagErr != nil {
+			return repos, errors.Join(err, tagErr)
+		}
+		return repos, err
 	}
 
-	var cleansedRepos []*github.Repository
+	var candidates []*github.Repository
 	opts := &github.RepositoryListByOrgOptions{
 		Type: "all",
 	}
@@ -37,17 +40,11 @@ func GatherRepositories(client *auth.GithubClient) ([]*github.Repository, error)
 
 			// remove untracked repositories
 			name := repo.GetName()
-			if name == "" || slices.Contains(internal.ExcludedRepositories, repo.GetName()) {
-				continue
-			}
-
-			// remove repos with no updates after our specified date
-			if repo.GetPushedAt().Before(client.Date) {
+			if name == "" || client.Exclusions.ExcludeRepo(name) {
 				continue
 			}
 
-			zap.S().Named("github").Debugf("found repo %s", repo.GetName())
-			cleansedRepos = append(cleansedRepos, repo)
+			candidates = append(candidates, repo)
 		}
 
 		if resp.NextPage == 0 {
@@ -55,6 +52,21 @@ func GatherRepositories(client *auth.GithubClient) ([]*github.Repository, error)
 		}
 		opts.Page = resp.NextPage
 	}
+
+	if err := resolveTagWindows(client, candidates); err != nil {
+		return nil, err
+	}
+
+	var cleansedRepos []*github.Repository
+	for _, repo := range candidates {
+		// remove repos with no updates after our specified date
+		if repo.GetPushedAt().Before(client.Window(repo.GetName()).Start) {
+			continue
+		}
+
+		zap.S().Named("github").Debugf("found repo %s", repo.GetName())
+		cleansedRepos = append(cleansedRepos, repo)
+	}
 	return cleansedRepos, nil
 }
 
@@ -83,17 +95,29 @@ func gatherSpecificRepositories(client *auth.GithubClient) ([]*github.Repository
 // GatherReleaseRepositories gathers all repositories with a branch matching
 // the specified release branch from a provided set of repositories.
 func GatherReleaseRepositories(client *auth.GithubClient, repos []*github.Repository) (map[string]*github.Repository, error) {
+	if client.API == auth.APIGraphQL {
+		return gatherReleaseRepositoriesGraphQL(client, repos)
+	}
+
 	patchRepos := map[string]*github.Repository{}
-	var hadError bool
+	hasBranch := make([]bool, len(repos))
+	errs := forEach(client, len(repos), func(i int) error {
+		var err error
+		hasBranch[i], err = checkForReleaseBranch(client, repos[i])
+		return err
+	})
+	if err := client.Ctx.Err(); err != nil {
+		return patchRepos, err
+	}
 
-	for _, repo := range repos {
-		hasBranch, err := checkForReleaseBranch(client, repo)
-		if err != nil {
-			zap.S().Named("github").Errorf("failed to list branches for repo %s/%s: %v", client.Org, repo.GetName(), err)
+	var hadError bool
+	for i, repo := range repos {
+		if errs[i] != nil {
+			zap.S().Named("github").Errorf("failed to list branches for repo %s/%s: %v", client.Org, repo.GetName(), errs[i])
 			hadError = true
 		}
 
-		if hasBranch {
+		if hasBranch[i] {
 			zap.S().Named("github").Debugf("found patch repo %s", repo.GetName())
 			patchRepos[client.Org+"/"+repo.GetName()] = repo
 		}
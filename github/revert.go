@@ -0,0 +1,261 @@
+package github
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-github/v67/github"
+	"go.uber.org/zap"
+
+	"github.com/serenibyss/nhprtracker/auth"
+)
+
+// Ways reverted PRs can be handled in reports.
+const (
+	RevertsFlag   = "flag"
+	RevertsDrop   = "drop"
+	RevertsIgnore = "ignore"
+)
+
+var (
+	// revertTitlePattern matches the title GitHub and git give reverts.
+	revertTitlePattern = regexp.MustCompile(`^Revert "(.+)"`)
+	// revertsPRPattern matches the body of PRs made with GitHub's revert button.
+	revertsPRPattern = regexp.MustCompile(`(?i)\breverts\s+(?:[\w.-]+/[\w.-]+)?#(\d+)`)
+	// revertsCommitPattern matches the message 'git revert' writes.
+	revertsCommitPattern = regexp.MustCompile(`This reverts commit ([0-9a-f]{7,40})`)
+)
+
+// Revert is what reverted a merged PR.
+type Revert struct {
+	// PR is the PR that reverted it, or nil if the revert was pushed as a
+	// commit without a PR.
+	PR *github.PullRequest
+
+	// SHA is the revert commit, if known.
+	SHA string
+}
+
+// Reverts links merged PRs with the PRs or commits that reverted them.
+type Reverts struct {
+	// By maps each reverted PR to what reverted it.
+	By map[*github.PullRequest]*Revert
+
+	// Of maps each revert PR to the PR it reverted.
+	Of map[*github.PullRequest]*github.PullRequest
+}
+
+// RevertedBy returns what reverted the PR, or nil if it was not reverted.
+func (r *Reverts) RevertedBy(pr *github.PullRequest) *Revert {
+	if r == nil {
+		return nil
+	}
+	return r.By[pr]
+}
+
+// RevertOf returns the PR reverted by the passed PR, or nil if it is not a
+// revert of a PR in the report.
+func (r *Reverts) RevertOf(pr *github.PullRequest) *github.PullRequest {
+	if r == nil {
+		return nil
+	}
+	return r.Of[pr]
+}
+
+// Drop returns the PR map without reverted PRs and the PRs reverting them.
+func (r *Reverts) Drop(prMap map[string][]*github.PullRequest) map[string][]*github.PullRequest {
+	newPrMap := map[string][]*github.PullRequest{}
+	for repoName, prs := range prMap {
+		var kept []*github.PullRequest
+		for _, pr := range prs {
+			if r.RevertedBy(pr) != nil || r.RevertOf(pr) != nil {
+				zap.S().Named("github").Debugf("dropping reverted PR #%d on repo %s", pr.GetNumber(), repoName)
+				continue
+			}
+			kept = append(kept, pr)
+		}
+		if len(kept) != 0 {
+			newPrMap[repoName] = kept
+		}
+	}
+	return newPrMap
+}
+
+// CheckRevertsMode validates the way reverted PRs are handled.
+func CheckRevertsMode(mode string) error {
+	switch mode {
+	case RevertsFlag, RevertsDrop, RevertsIgnore:
+		return nil
+	default:
+		return fmt.Errorf("unsupported reverts option %s, allowed: '%s', '%s', '%s'", mode, RevertsFlag, RevertsDrop, RevertsIgnore)
+	}
+}
+
+// ApplyReverts handles reverted PRs according to mode. With RevertsDrop they
+// and their reverts are removed from the returned map, with RevertsFlag they
+// are kept and the detected reverts returned so reports can mark them, and
+// with RevertsIgnore detection is skipped entirely.
+func ApplyReverts(client *auth.GithubClient, prMap map[string][]*github.PullRequest, repos []*github.Repository, mode string) (map[string][]*github.PullRequest, *Reverts, error) {
+	if err := CheckRevertsMode(mode); err != nil {
+		return prMap, nil, err
+	}
+	if mode == RevertsIgnore {
+		return prMap, nil, nil
+	}
+
+	reverts, err := DetectReverts(client, prMap, repos)
+	if mode == RevertsDrop {
+		return reverts.Drop(prMap), nil, err
+	}
+	return prMap, reverts, err
+}
+
+// DetectReverts finds merged PRs that were later reverted, either by another
+// PR in the map or by a commit pushed to the default branch within the window
+// of the repository. A revert that was itself reverted leaves the original PR
+// in place, and is paired with the PR reverting it instead.
+func DetectReverts(client *auth.GithubClient, prMap map[string][]*github.PullRequest, repos []*github.Repository) (*Reverts, error) {
+	reverts := &Reverts{
+		By: map[*github.PullRequest]*Revert{},
+		Of: map[*github.PullRequest]*github.PullRequest{},
+	}
+
+	// Revert commits pushed without a PR only show up in the branch history
+	var repoNames []string
+	for _, repo := range repos {
+		if len(prMap[client.Org+"/"+repo.GetName()]) != 0 {
+			repoNames = append(repoNames, repo.GetName())
+		}
+	}
+	commits := make([][]*github.RepositoryCommit, len(repoNames))
+	errs := forEach(client, len(repoNames), func(i int) error {
+		var err error
+		commits[i], err = gatherRevertCommits(client, repoNames[i])
+		return err
+	})
+	if err := client.Ctx.Err(); err != nil {
+		return reverts, err
+	}
+
+	var hadError bool
+	for i, repoName := range repoNames {
+		if errs[i] != nil {
+			zap.S().Named("github").Errorf("failed to list commits for repo %s/%s: %v", client.Org, repoName, errs[i])
+			hadError = true
+		}
+
+		prs := prMap[client.Org+"/"+repoName]
+
+		// Newest first, so a revert of a revert is seen before the revert it undoes
+		sorted := slices.Clone(prs)
+		slices.SortFunc(sorted, func(a, b *github.PullRequest) int {
+			return b.GetMergedAt().Compare(a.GetMergedAt().Time)
+		})
+
+		for _, pr := range sorted {
+			original := findRevertedPR(pr, prs)
+			if original == nil || reverts.By[pr] != nil {
+				continue
+			}
+			zap.S().Named("github").Debugf("found PR #%d reverting PR #%d on repo %s", pr.GetNumber(), original.GetNumber(), repoName)
+			reverts.By[original] = &Revert{PR: pr, SHA: pr.GetMergeCommitSHA()}
+			reverts.Of[pr] = original
+		}
+
+		for _, commit := range commits[i] {
+			// reverts merged through a PR were handled above
+			if slices.ContainsFunc(prs, func(pr *github.PullRequest) bool {
+				return pr.GetMergeCommitSHA() == commit.GetSHA()
+			}) {
+				continue
+			}
+			for _, match := range revertsCommitPattern.FindAllStringSubmatch(commit.GetCommit().GetMessage(), -1) {
+				for _, pr := range prs {
+					if reverts.By[pr] != nil || !shaMatches(pr.GetMergeCommitSHA(), match[1]) {
+						continue
+					}
+					zap.S().Named("github").Debugf("found commit %s reverting PR #%d on repo %s", commit.GetSHA(), pr.GetNumber(), repoName)
+					reverts.By[pr] = &Revert{SHA: commit.GetSHA()}
+				}
+			}
+		}
+	}
+
+	if hadError {
+		return reverts, errors.New("some repos could not be checked for revert commits, see logs above")
+	}
+	return reverts, nil
+}
+
+// findRevertedPR returns the PR reverted by the passed PR, if it is among prs.
+func findRevertedPR(pr *github.PullRequest, prs []*github.PullRequest) *github.PullRequest {
+	text := pr.GetTitle() + "\n" + pr.GetBody()
+
+	for _, match := range revertsPRPattern.FindAllStringSubmatch(text, -1) {
+		number, err := strconv.Atoi(match[1])
+		if err != nil {
+			continue
+		}
+		for _, original := range prs {
+			if original != pr && original.GetNumber() == number {
+				return original
+			}
+		}
+	}
+
+	for _, match := range revertsCommitPattern.FindAllStringSubmatch(text, -1) {
+		for _, original := range prs {
+			if original != pr && shaMatches(original.GetMergeCommitSHA(), match[1]) {
+				return original
+			}
+		}
+	}
+
+	if match := revertTitlePattern.FindStringSubmatch(pr.GetTitle()); match != nil {
+		for _, original := range prs {
+			if original != pr && strings.EqualFold(original.GetTitle(), match[1]) {
+				return original
+			}
+		}
+	}
+	return nil
+}
+
+// gatherRevertCommits lists the commits on the default branch within the
+// window of the repository that revert another commit.
+func gatherRevertCommits(client *auth.GithubClient, repoName string) ([]*github.RepositoryCommit, error) {
+	var revertCommits []*github.RepositoryCommit
+	window := client.Window(repoName)
+	opts := &github.CommitsListOptions{
+		Since: window.Start,
+		Until: window.End,
+	}
+
+	for {
+		commits, resp, err := client.Repositories.ListCommits(client.Ctx, client.Org, repoName, opts)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, commit := range commits {
+			if revertsCommitPattern.MatchString(commit.GetCommit().GetMessage()) {
+				revertCommits = append(revertCommits, commit)
+			}
+		}
+
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+	return revertCommits, nil
+}
+
+// shaMatches compares a full SHA with a possibly abbreviated one.
+func shaMatches(full, short string) bool {
+	return full != "" && len(short) >= 7 && strings.HasPrefix(full, short)
+}
@@ -0,0 +1,163 @@
+package github
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v67/github"
+)
+
+// mergedPR creates a PR merged on the day of January 2024 as the commit.
+func mergedPR(number, day int, title, body, sha string) *github.PullRequest {
+	return &github.PullRequest{
+		Number:         github.Int(number),
+		Title:          github.String(title),
+		Body:           github.String(body),
+		MergeCommitSHA: github.String(sha),
+		MergedAt:       &github.Timestamp{Time: time.Date(2024, time.January, day, 0, 0, 0, 0, time.UTC)},
+	}
+}
+
+func TestFindRevertedPR(t *testing.T) {
+	original := mergedPR(12, 1, "Add ore processing", "", "4b825dc642cb6eb9a060e54bf8d69288fbee4904")
+	other := mergedPR(13, 2, "Fix crash", "", "e69de29bb2d1d6434b8b29ae775ad8c2e48c5391")
+	prs := []*github.PullRequest{original, other}
+
+	tests := []struct {
+		name  string
+		title string
+		body  string
+		want  *github.PullRequest
+	}{
+		{name: "reverts button body", title: "Revert #12", body: "Reverts org/repo#12", want: original},
+		{name: "reverts without repo", title: "Undo ore processing", body: "reverts #12", want: original},
+		{name: "reverts in title", title: "Reverts org/repo#12", want: original},
+		{name: "revert commit message", title: "Undo ore processing", body: "This reverts commit 4b825dc642cb6eb9a060e54bf8d69288fbee4904.", want: original},
+		{name: "abbreviated commit", title: "Undo ore processing", body: "This reverts commit 4b825dc.", want: original},
+		{name: "too short commit", title: "Undo ore processing", body: "This reverts commit 4b825d."},
+		{name: "unknown commit", title: "Undo ore processing", body: "This reverts commit 0123456789abcdef."},
+		{name: "revert title", title: `Revert "Add ore processing"`, want: original},
+		{name: "revert title case-insensitive", title: `Revert "add ore processing"`, want: original},
+		{name: "PR number wins over title", title: `Revert "Add ore processing"`, body: "Reverts org/repo#13", want: other},
+		{name: "unknown PR number", title: "Undo", body: "Reverts org/repo#99"},
+		{name: "not a revert", title: "Add ore processing again", body: "Follow-up to #12"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pr := mergedPR(20, 3, tt.title, tt.body, "da39a3ee5e6b4b0d3255bfef95601890afd80709")
+			if got := findRevertedPR(pr, append(prs, pr)); got != tt.want {
+				t.Errorf("findRevertedPR() = #%d, want #%d", got.GetNumber(), tt.want.GetNumber())
+			}
+		})
+	}
+}
+
+func TestFindRevertedPRSkipsItself(t *testing.T) {
+	pr := mergedPR(12, 1, `Revert "Reverts org/repo#12"`, "Reverts org/repo#12", "4b825dc642cb6eb9a060e54bf8d69288fbee4904")
+	if got := findRevertedPR(pr, []*github.PullRequest{pr}); got != nil {
+		t.Errorf("findRevertedPR() = #%d, want none", got.GetNumber())
+	}
+}
+
+func TestDetectReverts(t *testing.T) {
+	feature := mergedPR(1, 1, "Add ore processing", "", "1111111111111111111111111111111111111111")
+	revert := mergedPR(2, 2, `Revert "Add ore processing"`, "Reverts org/repo#1", "2222222222222222222222222222222222222222")
+	reapply := mergedPR(3, 3, `Revert "Revert "Add ore processing""`, "Reverts org/repo#2", "3333333333333333333333333333333333333333")
+	fix := mergedPR(4, 4, "Fix crash", "", "4444444444444444444444444444444444444444")
+	kept := mergedPR(5, 5, "Update docs", "", "5555555555555555555555555555555555555555")
+	prMap := map[string][]*github.PullRequest{"org/repo": {feature, revert, reapply, fix, kept}}
+
+	commits := []*github.RepositoryCommit{
+		// merged through revert, already handled as a PR
+		{SHA: github.String(revert.GetMergeCommitSHA()), Commit: &github.Commit{Message: github.String("Revert \"Add ore processing\"\n\nThis reverts commit 1111111.")}},
+		{SHA: github.String("6666666666666666666666666666666666666666"), Commit: &github.Commit{Message: github.String("Revert \"Fix crash\"\n\nThis reverts commit 4444444444444444444444444444444444444444.")}},
+	}
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/repos/org/repo/commits" {
+			t.Errorf("unexpected request to %s", r.URL.Path)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(commits); err != nil {
+			t.Error(err)
+		}
+	}))
+
+	reverts, err := DetectReverts(client, prMap, []*github.Repository{{Name: github.String("repo")}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the revert of the revert pairs with the revert, leaving the feature in
+	wantBy := map[*github.PullRequest]*Revert{
+		revert: {PR: reapply, SHA: reapply.GetMergeCommitSHA()},
+		fix:    {SHA: "6666666666666666666666666666666666666666"},
+	}
+	wantOf := map[*github.PullRequest]*github.PullRequest{reapply: revert}
+	if !reflect.DeepEqual(reverts.By, wantBy) {
+		for pr, by := range reverts.By {
+			t.Errorf("PR #%d reverted by PR #%d commit %s", pr.GetNumber(), by.PR.GetNumber(), by.SHA)
+		}
+		t.Errorf("By does not pair each reverted PR with its revert")
+	}
+	if !reflect.DeepEqual(reverts.Of, wantOf) {
+		for pr, of := range reverts.Of {
+			t.Errorf("PR #%d reverts PR #%d", pr.GetNumber(), of.GetNumber())
+		}
+		t.Errorf("Of does not pair each revert with the PR it reverts")
+	}
+}
+
+func TestRevertsDrop(t *testing.T) {
+	feature := mergedPR(1, 1, "Add ore processing", "", "1111111111111111111111111111111111111111")
+	revert := mergedPR(2, 2, `Revert "Add ore processing"`, "Reverts org/repo#1", "2222222222222222222222222222222222222222")
+	fix := mergedPR(3, 3, "Fix crash", "", "3333333333333333333333333333333333333333")
+	other := mergedPR(1, 1, "Update docs", "", "4444444444444444444444444444444444444444")
+	prMap := map[string][]*github.PullRequest{
+		"org/repo":  {feature, revert, fix},
+		"org/other": {other},
+	}
+
+	tests := []struct {
+		name    string
+		reverts *Reverts
+		want    map[string][]*github.PullRequest
+	}{
+		{
+			name: "reverted by PR",
+			reverts: &Reverts{
+				By: map[*github.PullRequest]*Revert{feature: {PR: revert}},
+				Of: map[*github.PullRequest]*github.PullRequest{revert: feature},
+			},
+			want: map[string][]*github.PullRequest{"org/repo": {fix}, "org/other": {other}},
+		},
+		{
+			name:    "reverted by commit",
+			reverts: &Reverts{By: map[*github.PullRequest]*Revert{fix: {SHA: "5555555555555555555555555555555555555555"}}},
+			want:    map[string][]*github.PullRequest{"org/repo": {feature, revert}, "org/other": {other}},
+		},
+		{
+			name:    "repo left empty",
+			reverts: &Reverts{By: map[*github.PullRequest]*Revert{other: {SHA: "5555555555555555555555555555555555555555"}}},
+			want:    map[string][]*github.PullRequest{"org/repo": {feature, revert, fix}},
+		},
+		{
+			name:    "no reverts",
+			reverts: &Reverts{},
+			want:    prMap,
+		},
+		{
+			name: "nil reverts",
+			want: prMap,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.reverts.Drop(prMap); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Drop() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,496 @@
+package github
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/google/go-github/v67/github"
+	"go.uber.org/zap"
+
+	"github.com/serenibyss/nhprtracker/auth"
+)
+
+// Ways branch protection can be applied to release branches.
+const (
+	// ProtectClassic uses classic branch protection rules on each branch.
+	ProtectClassic = "classic"
+
+	// ProtectRepoRuleset uses a ruleset on each repository.
+	ProtectRepoRuleset = "repo-ruleset"
+
+	// ProtectOrgRuleset uses a single ruleset on the organization.
+	ProtectOrgRuleset = "org-ruleset"
+)
+
+// Types of the ruleset rules profiles are translated to.
+const (
+	rulePullRequest          = "pull_request"
+	ruleRequiredStatusChecks = "required_status_checks"
+	ruleLinearHistory        = "required_linear_history"
+	ruleNonFastForward       = "non_fast_forward"
+	ruleDeletion             = "deletion"
+)
+
+// rulesetSourceOrganization is the source type of rules set by an
+// organization ruleset.
+const rulesetSourceOrganization = "Organization"
+
+// CheckProtectMode validates the way branch protection is applied.
+func CheckProtectMode(mode string) error {
+	switch mode {
+	case ProtectClassic, ProtectRepoRuleset, ProtectOrgRuleset:
+		return nil
+	default:
+		return fmt.Errorf("unsupported mode option %s, allowed: '%s', '%s', '%s'", mode, ProtectClassic, ProtectRepoRuleset, ProtectOrgRuleset)
+	}
+}
+
+func enabled(v *bool) bool {
+	return v != nil && *v
+}
+
+// rulesetRules converts the rule to ruleset rules. Enforcement on admins is
+// not part of the rules, see newRuleset for its bypass actors.
+func (r *ProtectionRule) rulesetRules() []*github.RepositoryRule {
+	var rules []*github.RepositoryRule
+	if r.RequiredApprovals != nil {
+		rules = append(rules, github.NewPullRequestRule(&github.PullRequestRuleParameters{
+			RequiredApprovingReviewCount:   *r.RequiredApprovals,
+			RequireCodeOwnerReview:         enabled(r.RequireCodeOwnerReviews),
+			DismissStaleReviewsOnPush:      enabled(r.DismissStaleReviews),
+			RequiredReviewThreadResolution: enabled(r.RequireConversationResolution),
+		}))
+	}
+	if r.RequiredChecks != nil && len(*r.RequiredChecks) != 0 {
+		var checks []github.RuleRequiredStatusChecks
+		for _, check := range *r.RequiredChecks {
+			checks = append(checks, github.RuleRequiredStatusChecks{Context: check})
+		}
+		rules = append(rules, github.NewRequiredStatusChecksRule(&github.RequiredStatusChecksRuleParameters{
+			RequiredStatusChecks:             checks,
+			StrictRequiredStatusChecksPolicy: enabled(r.StrictChecks),
+		}))
+	}
+	if enabled(r.RequireLinearHistory) {
+		rules = append(rules, github.NewRequiredLinearHistoryRule())
+	}
+	if r.AllowForcePushes != nil && !*r.AllowForcePushes {
+		rules = append(rules, github.NewNonFastForwardRule())
+	}
+	if r.AllowDeletions != nil && !*r.AllowDeletions {
+		rules = append(rules, github.NewDeletionRule())
+	}
+	return rules
+}
+
+// protectionRuleOfRules converts ruleset rules back to a rule, or returns an
+// empty rule if there are none.
+func protectionRuleOfRules(rules []*github.RepositoryRule) (*ProtectionRule, error) {
+	rule := &ProtectionRule{}
+	if len(rules) == 0 {
+		return rule, nil
+	}
+
+	rule.RequireCodeOwnerReviews = github.Bool(false)
+	rule.DismissStaleReviews = github.Bool(false)
+	rule.RequiredChecks = &[]string{}
+	rule.StrictChecks = github.Bool(false)
+	rule.RequireConversationResolution = github.Bool(false)
+	rule.RequireLinearHistory = github.Bool(false)
+	rule.AllowForcePushes = github.Bool(true)
+	rule.AllowDeletions = github.Bool(true)
+
+	for _, r := range rules {
+		switch r.Type {
+		case rulePullRequest:
+			var params github.PullRequestRuleParameters
+			if r.Parameters != nil {
+				if err := json.Unmarshal(*r.Parameters, &params); err != nil {
+					return nil, fmt.Errorf("failed to read %s rule: %w", r.Type, err)
+				}
+			}
+			rule.RequiredApprovals = github.Int(params.RequiredApprovingReviewCount)
+			rule.RequireCodeOwnerReviews = github.Bool(params.RequireCodeOwnerReview)
+			rule.DismissStaleReviews = github.Bool(params.DismissStaleReviewsOnPush)
+			rule.RequireConversationResolution = github.Bool(params.RequiredReviewThreadResolution)
+		case ruleRequiredStatusChecks:
+			var params github.RequiredStatusChecksRuleParameters
+			if r.Parameters != nil {
+				if err := json.Unmarshal(*r.Parameters, &params); err != nil {
+					return nil, fmt.Errorf("failed to read %s rule: %w", r.Type, err)
+				}
+			}
+			checks := slices.Clone(*rule.RequiredChecks)
+			for _, check := range params.RequiredStatusChecks {
+				checks = append(checks, check.Context)
+			}
+			rule.RequiredChecks = &checks
+			rule.StrictChecks = github.Bool(params.StrictRequiredStatusChecksPolicy)
+		case ruleLinearHistory:
+			rule.RequireLinearHistory = github.Bool(true)
+		case ruleNonFastForward:
+			rule.AllowForcePushes = github.Bool(false)
+		case ruleDeletion:
+			rule.AllowDeletions = github.Bool(false)
+		}
+	}
+	return rule, nil
+}
+
+// Bypass actors exempting admins from a ruleset, as rulesets have no rule
+// enforcing them on admins like classic branch protection does.
+const (
+	bypassOrganizationAdmin = "OrganizationAdmin"
+	bypassRepositoryRole    = "RepositoryRole"
+	bypassModeAlways        = "always"
+
+	// organizationAdminActorID is the actor ID GitHub uses for organization
+	// admins, and repositoryAdminRoleID the ID of the repository admin role.
+	organizationAdminActorID = 1
+	repositoryAdminRoleID    = 5
+)
+
+// adminBypass returns the bypass actor exempting admins from an organization
+// or repository ruleset.
+func adminBypass(org bool) *github.BypassActor {
+	if org {
+		return &github.BypassActor{
+			ActorID:    github.Int64(organizationAdminActorID),
+			ActorType:  github.String(bypassOrganizationAdmin),
+			BypassMode: github.String(bypassModeAlways),
+		}
+	}
+	return &github.BypassActor{
+		ActorID:    github.Int64(repositoryAdminRoleID),
+		ActorType:  github.String(bypassRepositoryRole),
+		BypassMode: github.String(bypassModeAlways),
+	}
+}
+
+// hasAdminBypass checks if admins are exempted from a ruleset.
+func hasAdminBypass(actors []*github.BypassActor, org bool) bool {
+	want := adminBypass(org)
+	return slices.ContainsFunc(actors, func(actor *github.BypassActor) bool {
+		return actor.GetActorType() == want.GetActorType() && actor.GetActorID() == want.GetActorID()
+	})
+}
+
+// bypassActors returns the bypass actors of the existing ruleset, with the
+// admin bypass added or removed as the rule enforces it on admins. Other
+// actors are left alone.
+func bypassActors(existing *github.Ruleset, rule *ProtectionRule, org bool) []*github.BypassActor {
+	actors := []*github.BypassActor{}
+	if existing != nil {
+		actors = append(actors, existing.BypassActors...)
+	}
+	if rule.EnforceAdmins == nil {
+		return actors
+	}
+
+	bypass := hasAdminBypass(actors, org)
+	switch {
+	case *rule.EnforceAdmins && bypass:
+		admin := adminBypass(org)
+		actors = slices.DeleteFunc(actors, func(actor *github.BypassActor) bool {
+			return actor.GetActorType() == admin.GetActorType() && actor.GetActorID() == admin.GetActorID()
+		})
+	case !*rule.EnforceAdmins && !bypass:
+		actors = append(actors, adminBypass(org))
+	}
+	return actors
+}
+
+// newRuleset builds a ruleset enforcing the rule on the release branches,
+// replacing the existing ruleset if there is one. Organization rulesets only
+// target the passed repositories. Admins are exempted through a bypass actor
+// if the rule does not enforce it on them.
+func newRuleset(name string, branches, repos []string, rule *ProtectionRule, existing *github.Ruleset, org bool) *github.Ruleset {
+	var include []string
+	for _, branch := range branches {
+		include = append(include, "refs/heads/"+branch)
+	}
+
+	ruleset := &github.Ruleset{
+		Name:        name,
+		Target:      github.String("branch"),
+		Enforcement: "active",
+		Conditions: &github.RulesetConditions{
+			RefName: &github.RulesetRefConditionParameters{
+				Include: include,
+				Exclude: []string{},
+			},
+		},
+		Rules:        rule.rulesetRules(),
+		BypassActors: bypassActors(existing, rule, org),
+	}
+	if org {
+		ruleset.Conditions.RepositoryName = &github.RulesetRepositoryNamesConditionParameters{
+			Include: repos,
+			Exclude: []string{},
+		}
+	}
+	return ruleset
+}
+
+// rulesetChange plans creating or updating a ruleset, returning nil if the
+// existing ruleset already matches.
+func rulesetChange(repoName string, existing, desired *github.Ruleset, rule *ProtectionRule, org bool, apply func(client *auth.GithubClient) error) (*Change, error) {
+	current := &ProtectionRule{}
+	var currentRefs, currentRepos []string
+	action := "create-ruleset"
+	if existing != nil {
+		var err error
+		current, err = protectionRuleOfRules(existing.Rules)
+		if err != nil {
+			return nil, err
+		}
+		current.EnforceAdmins = github.Bool(!hasAdminBypass(existing.BypassActors, org))
+		if existing.Conditions != nil && existing.Conditions.RefName != nil {
+			currentRefs = existing.Conditions.RefName.Include
+		}
+		if existing.Conditions != nil && existing.Conditions.RepositoryName != nil {
+			currentRepos = existing.Conditions.RepositoryName.Include
+		}
+		action = "update-ruleset"
+	}
+
+	fields := diffProtection(current, rule)
+	if org {
+		if have, want := formatRefs(currentRepos), formatRefs(desired.Conditions.RepositoryName.Include); have != want {
+			fields = append([]FieldChange{{Field: "repos", Current: have, Desired: want}}, fields...)
+		}
+	}
+	if have, want := formatRefs(currentRefs), formatRefs(desired.Conditions.RefName.Include); have != want {
+		fields = append([]FieldChange{{Field: "branches", Current: have, Desired: want}}, fields...)
+	}
+	if existing != nil && existing.Enforcement != desired.Enforcement {
+		fields = append(fields, FieldChange{Field: "enforcement", Current: existing.Enforcement, Desired: desired.Enforcement})
+	}
+	if existing != nil && len(fields) == 0 {
+		return nil, nil
+	}
+
+	return &Change{
+		Repo:   repoName,
+		Target: desired.Name,
+		Action: action,
+		Fields: fields,
+		apply:  apply,
+	}, nil
+}
+
+func formatRefs(refs []string) string {
+	if refs == nil {
+		return unsetField
+	}
+	return formatList(&refs)
+}
+
+// findRuleset returns the ruleset with the name, or nil if there is none.
+func findRuleset(rulesets []*github.Ruleset, name string) *github.Ruleset {
+	for _, ruleset := range rulesets {
+		if ruleset.Name == name {
+			return ruleset
+		}
+	}
+	return nil
+}
+
+// PlanOrgRuleset plans creating or updating a single organization ruleset
+// protecting the release branches of the client on the repositories having
+// one. Repositories gaining a release branch later need it planned again. All
+// release branches must resolve to the same profile, and repository overrides
+// do not apply.
+func PlanOrgRuleset(client *auth.GithubClient, profiles []*ProtectionProfile, name string) (*Plan, error) {
+	var rule *ProtectionRule
+	for _, branch := range client.Branches {
+		resolved := ResolveProtection(profiles, "", branch)
+		if resolved == nil {
+			return nil, fmt.Errorf("no protection profile matches release branch %s", branch)
+		}
+		if rule != nil && (len(diffProtection(rule, resolved)) != 0 || len(diffProtection(resolved, rule)) != 0) {
+			return nil, errors.New("release branches resolve to different protection profiles, which a single organization ruleset cannot express")
+		}
+		rule = resolved
+	}
+
+	// Only target the repositories classic protection would, leaving out
+	// private, archived and excluded ones
+	targets, err := gatherProtectionTargets(client)
+	if err != nil {
+		return nil, err
+	}
+	var repos []string
+	for _, target := range targets {
+		if !slices.Contains(repos, target.Repo.GetName()) {
+			repos = append(repos, target.Repo.GetName())
+		}
+	}
+	slices.Sort(repos)
+	if len(repos) == 0 {
+		return nil, errors.New("no repositories have a release branch to protect")
+	}
+
+	// Fetch the full ruleset, as the list does not include conditions or rules
+	rulesets, _, err := client.Organizations.GetAllOrganizationRulesets(client.Ctx, client.Org)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list organization rulesets: %w", err)
+	}
+	existing := findRuleset(rulesets, name)
+	if existing != nil {
+		existing, _, err = client.Organizations.GetOrganizationRuleset(client.Ctx, client.Org, existing.GetID())
+		if err != nil {
+			return nil, fmt.Errorf("failed to get organization ruleset %s: %w", name, err)
+		}
+	}
+
+	desired := newRuleset(name, client.Branches, repos, rule, existing, true)
+	change, err := rulesetChange("", existing, desired, rule, true, func(client *auth.GithubClient) error {
+		var err error
+		if existing != nil {
+			err = updateOrganizationRuleset(client, existing.GetID(), desired)
+		} else {
+			_, _, err = client.Organizations.CreateOrganizationRuleset(client.Ctx, client.Org, desired)
+		}
+		if err == nil {
+			zap.S().Named("rules").Infof("applied ruleset %s on organization %s", name, client.Org)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &Plan{}
+	if change != nil {
+		plan.add(change)
+	}
+	return plan, nil
+}
+
+// PlanRepoRulesets plans creating or updating a ruleset on each repository
+// with a branch matching the release branches of the client, protecting the
+// branch with its profile. Branches already covered by an organization
+// ruleset are left alone.
+func PlanRepoRulesets(client *auth.GithubClient, profiles []*ProtectionProfile, name string) (*Plan, error) {
+	targets, err := gatherProtectionTargets(client)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make([]*Change, len(targets))
+	errs := forEach(client, len(targets), func(i int) error {
+		var err error
+		changes[i], err = planRepoRuleset(client, profiles, name, targets[i])
+		return err
+	})
+	if err := client.Ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	plan := &Plan{}
+	var hadError bool
+	for i, target := range targets {
+		if errs[i] != nil {
+			zap.S().Named("rules").Errorf("failed to check ruleset for branch %s on repo %s: %v", target.Branch, target.Repo.GetName(), errs[i])
+			hadError = true
+			continue
+		}
+		if changes[i] != nil {
+			plan.add(changes[i])
+		}
+	}
+	plan.sort()
+
+	if hadError {
+		return plan, errors.New("some rulesets could not be checked, see logs above")
+	}
+	return plan, nil
+}
+
+func planRepoRuleset(client *auth.GithubClient, profiles []*ProtectionProfile, name string, target *repoBranch) (*Change, error) {
+	repoName := target.Repo.GetName()
+	covered, err := coveredByOrgRuleset(client, repoName, target.Branch)
+	if err != nil {
+		return nil, err
+	}
+	if covered {
+		zap.S().Named("rules").Infof("branch %s on repo %s is covered by an organization ruleset, skipping", target.Branch, repoName)
+		return nil, nil
+	}
+
+	rule := ResolveProtection(profiles, repoName, target.Branch)
+	if rule == nil {
+		zap.S().Named("rules").Warnf("no protection profile matches branch %s on repo %s, skipping", target.Branch, repoName)
+		return nil, nil
+	}
+
+	// One ruleset per branch, as each branch may resolve to its own profile
+	rulesetName := fmt.Sprintf("%s (%s)", name, target.Branch)
+	rulesets, _, err := client.Repositories.GetAllRulesets(client.Ctx, client.Org, repoName, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list rulesets: %w", err)
+	}
+	existing := findRuleset(rulesets, rulesetName)
+	if existing != nil {
+		existing, _, err = client.Repositories.GetRuleset(client.Ctx, client.Org, repoName, existing.GetID(), false)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get ruleset %s: %w", rulesetName, err)
+		}
+	}
+
+	desired := newRuleset(rulesetName, []string{target.Branch}, nil, rule, existing, false)
+	return rulesetChange(repoName, existing, desired, rule, false, func(client *auth.GithubClient) error {
+		var err error
+		if existing != nil {
+			// sends the bypass actors even if empty, so admin bypasses can
+			// be removed
+			_, _, err = client.Repositories.UpdateRulesetNoBypassActor(client.Ctx, client.Org, repoName, existing.GetID(), desired)
+		} else {
+			_, _, err = client.Repositories.CreateRuleset(client.Ctx, client.Org, repoName, desired)
+		}
+		if err == nil {
+			zap.S().Named("rules").Infof("applied ruleset %s on repo %s/%s", rulesetName, client.Org, repoName)
+		}
+		return err
+	})
+}
+
+// organizationRulesetUpdate is the body of an organization ruleset update,
+// which sends the bypass actors even if empty so admin bypasses can be
+// removed.
+type organizationRulesetUpdate struct {
+	*github.Ruleset
+	BypassActors []*github.BypassActor `json:"bypass_actors"`
+}
+
+// updateOrganizationRuleset replaces an organization ruleset.
+func updateOrganizationRuleset(client *auth.GithubClient, id int64, ruleset *github.Ruleset) error {
+	body := &organizationRulesetUpdate{Ruleset: ruleset, BypassActors: ruleset.BypassActors}
+	if body.BypassActors == nil {
+		body.BypassActors = []*github.BypassActor{}
+	}
+	req, err := client.NewRequest(http.MethodPut, fmt.Sprintf("orgs/%s/rulesets/%d", client.Org, id), body)
+	if err != nil {
+		return err
+	}
+	_, err = client.Do(client.Ctx, req, nil)
+	return err
+}
+
+// coveredByOrgRuleset checks if an organization ruleset already requires PRs
+// or status checks on the branch.
+func coveredByOrgRuleset(client *auth.GithubClient, repoName, branch string) (bool, error) {
+	rules, _, err := client.Repositories.GetRulesForBranch(client.Ctx, client.Org, repoName, branch)
+	if err != nil {
+		return false, fmt.Errorf("failed to get rules for branch %s: %w", branch, err)
+	}
+	return slices.ContainsFunc(rules, func(rule *github.RepositoryRule) bool {
+		return strings.EqualFold(rule.RulesetSourceType, rulesetSourceOrganization) &&
+			(rule.Type == rulePullRequest || rule.Type == ruleRequiredStatusChecks)
+	}), nil
+}
@@ -0,0 +1,82 @@
+package github
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/go-github/v67/github"
+	"go.uber.org/zap"
+
+	"github.com/serenibyss/nhprtracker/auth"
+)
+
+// resolveTagWindows bounds the window of each repository by the commit dates
+// of the client's since and until tags. Repositories without a tag keep the
+// start or end date of the client for that side of their window.
+func resolveTagWindows(client *auth.GithubClient, repos []*github.Repository) error {
+	if client.SinceTag == "" && client.UntilTag == "" {
+		return nil
+	}
+
+	windows := make([]auth.Window, len(repos))
+	errs := forEach(client, len(repos), func(i int) error {
+		repoName := repos[i].GetName()
+		windows[i] = client.Window(repoName)
+
+		for _, bound := range []struct {
+			tag  string
+			date *time.Time
+		}{
+			{client.SinceTag, &windows[i].Start},
+			{client.UntilTag, &windows[i].End},
+		} {
+			if bound.tag == "" {
+				continue
+			}
+			date, ok, err := tagDate(client, repoName, bound.tag)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				zap.S().Named("github").Debugf("no tag %s on repo %s, using default window", bound.tag, repoName)
+				continue
+			}
+			*bound.date = date
+		}
+		return nil
+	})
+	if err := client.Ctx.Err(); err != nil {
+		return err
+	}
+
+	var hadError bool
+	for i, repo := range repos {
+		if errs[i] != nil {
+			zap.S().Named("github").Errorf("failed to resolve tags for repo %s/%s: %v", client.Org, repo.GetName(), errs[i])
+			hadError = true
+			continue
+		}
+		zap.S().Named("github").Debugf("window for repo %s: %s to %s", repo.GetName(), windows[i].Start.Format(time.RFC3339), windows[i].End.Format(time.RFC3339))
+		client.SetWindow(repo.GetName(), windows[i])
+	}
+
+	if hadError {
+		return errors.New("some repo tags could not be resolved, see logs above")
+	}
+	return nil
+}
+
+// tagDate returns the commit date of the tag on the repository, and whether
+// the repository has the tag at all.
+func tagDate(client *auth.GithubClient, repoName, tag string) (time.Time, bool, error) {
+	commit, resp, err := client.Repositories.GetCommit(client.Ctx, client.Org, repoName, "refs/tags/"+tag, nil)
+	if err != nil {
+		if resp != nil && (resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusUnprocessableEntity) {
+			return time.Time{}, false, nil
+		}
+		return time.Time{}, false, fmt.Errorf("failed to get tag %s: %w", tag, err)
+	}
+	return commit.GetCommit().GetCommitter().GetDate().Time, true, nil
+}
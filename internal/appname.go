@@ -12,6 +12,8 @@ const (
 	DefaultReleaseBranch = "release/2.7.x"
 	DefaultStartDate     = "2024-12-08"
 	DefaultFormatting    = "terminal"
+	DefaultConcurrency   = 4
+	DefaultRulesetName   = "release branches"
 )
 
 // Set via LDFLAGS -X
@@ -38,7 +40,14 @@ var (
 
 	// ExcludedPRTitles are to catch PRs that don't need to be reported, like spotless formatting PRs
 	ExcludedPRTitles = []string{
-		"Spotless apply for branch",
+		"*Spotless apply for branch*",
+	}
+
+	// ExcludedPRAuthors are bots opening PRs that don't need to be reported
+	ExcludedPRAuthors = []string{
+		"dependabot[bot]",
+		"renovate[bot]",
+		"github-actions[bot]",
 	}
 )
 
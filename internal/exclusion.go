@@ -0,0 +1,169 @@
+package internal
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// regexPrefix marks a pattern as a regular expression rather than a glob.
+const regexPrefix = "re:"
+
+// Pattern matches values against a glob, where '*' matches any run of
+// characters and '?' any single one, or against a regular expression when
+// prefixed with "re:". Globs match the whole value, regular expressions any
+// part of it.
+type Pattern struct {
+	raw string
+	re  *regexp.Regexp
+}
+
+// ParsePattern compiles a glob or "re:" prefixed regular expression.
+func ParsePattern(raw string) (*Pattern, error) {
+	if expr, ok := strings.CutPrefix(raw, regexPrefix); ok {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("pattern %q malformed: %w", raw, err)
+		}
+		return &Pattern{raw: raw, re: re}, nil
+	}
+
+	var expr strings.Builder
+	expr.WriteString("^")
+	for _, r := range raw {
+		switch r {
+		case '*':
+			expr.WriteString(".*")
+		case '?':
+			expr.WriteString(".")
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	expr.WriteString("$")
+	return &Pattern{raw: raw, re: regexp.MustCompile(expr.String())}, nil
+}
+
+// ParsePatterns compiles a list of patterns.
+func ParsePatterns(raws []string) ([]*Pattern, error) {
+	var patterns []*Pattern
+	for _, raw := range raws {
+		pattern, err := ParsePattern(raw)
+		if err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, nil
+}
+
+// Match checks if the value matches the pattern.
+func (p *Pattern) Match(value string) bool {
+	return p.re.MatchString(value)
+}
+
+// String returns the pattern as it was written.
+func (p *Pattern) String() string {
+	return p.raw
+}
+
+// ExclusionCount is the number of PRs left out of a report by an exclusion
+// rule.
+type ExclusionCount struct {
+	Rule  string `json:"rule"`
+	Count int    `json:"count"`
+}
+
+// Exclusions holds the repositories and PRs left out of reports, and counts
+// the PRs each rule filtered. It is safe for concurrent use.
+type Exclusions struct {
+	Repos   []*Pattern
+	Titles  []*Pattern
+	Authors []*Pattern
+
+	// Labels are the names of labels whose PRs are left out.
+	Labels []string
+
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+// ExcludeRepo checks if a repository is excluded.
+func (e *Exclusions) ExcludeRepo(name string) bool {
+	if e == nil {
+		return false
+	}
+	for _, pattern := range e.Repos {
+		if pattern.Match(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// ExcludePR checks if a PR with the title, author and labels is excluded,
+// counting it against the first rule it matches.
+func (e *Exclusions) ExcludePR(title, author string, labels []string) bool {
+	if e == nil {
+		return false
+	}
+	for _, pattern := range e.Titles {
+		if pattern.Match(title) {
+			e.count("title " + pattern.String())
+			return true
+		}
+	}
+	for _, pattern := range e.Authors {
+		if pattern.Match(author) {
+			e.count("author " + pattern.String())
+			return true
+		}
+	}
+	for _, label := range e.Labels {
+		for _, name := range labels {
+			if strings.EqualFold(label, name) {
+				e.count("label " + label)
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (e *Exclusions) count(rule string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.counts == nil {
+		e.counts = map[string]int{}
+	}
+	e.counts[rule]++
+}
+
+// Counts returns the number of PRs filtered by each rule that filtered any,
+// in the order the rules are checked.
+func (e *Exclusions) Counts() []ExclusionCount {
+	if e == nil {
+		return nil
+	}
+	var rules []string
+	for _, pattern := range e.Titles {
+		rules = append(rules, "title "+pattern.String())
+	}
+	for _, pattern := range e.Authors {
+		rules = append(rules, "author "+pattern.String())
+	}
+	for _, label := range e.Labels {
+		rules = append(rules, "label "+label)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var counts []ExclusionCount
+	for _, rule := range rules {
+		if count := e.counts[rule]; count != 0 {
+			counts = append(counts, ExclusionCount{Rule: rule, Count: count})
+		}
+	}
+	return counts
+}
@@ -0,0 +1,107 @@
+package internal
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParsePattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		value   string
+		want    bool
+	}{
+		{"GT5-Unofficial", "GT5-Unofficial", true},
+		{"GT5-Unofficial", "GT5-Unofficial-Fork", false},
+		{"GT5-Unofficial", "My-GT5-Unofficial", false},
+		{"*-Fork", "GT5-Unofficial-Fork", true},
+		{"*-Fork", "GT5-Unofficial-Fork-Old", false},
+		{"Spotless*", "Spotless apply for branch master", true},
+		{"Spotless*", "Run Spotless", false},
+		{"v?.x", "v2.x", true},
+		{"v?.x", "v2Ax", false},
+		{"v?.x", "v10.x", false},
+		{"dependabot[bot]", "dependabot[bot]", true},
+		{"dependabot[bot]", "dependabotb", false},
+		{"(draft)*", "(draft) New thing", true},
+		{"re:^WIP", "WIP: New thing", true},
+		{"re:^WIP", "Not WIP", false},
+		{"re:bump", "Chore: bump versions", true},
+		{"re:(?i)bump", "Chore: Bump versions", true},
+	}
+	for _, tt := range tests {
+		pattern, err := ParsePattern(tt.pattern)
+		if err != nil {
+			t.Fatalf("ParsePattern(%q): %v", tt.pattern, err)
+		}
+		if got := pattern.Match(tt.value); got != tt.want {
+			t.Errorf("pattern %q matches %q = %v, want %v", tt.pattern, tt.value, got, tt.want)
+		}
+		if pattern.String() != tt.pattern {
+			t.Errorf("pattern %q String() = %q", tt.pattern, pattern.String())
+		}
+	}
+}
+
+func TestParsePatternMalformed(t *testing.T) {
+	if _, err := ParsePattern("re:(unclosed"); err == nil {
+		t.Error("ParsePattern succeeded on a malformed regular expression")
+	}
+	if _, err := ParsePattern("(unclosed"); err != nil {
+		t.Errorf("ParsePattern failed on a glob with regular expression syntax: %v", err)
+	}
+}
+
+func TestExclusionsCounts(t *testing.T) {
+	mustParse := func(raws ...string) []*Pattern {
+		patterns, err := ParsePatterns(raws)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return patterns
+	}
+	e := &Exclusions{
+		Titles:  mustParse("*Spotless*", "re:^WIP"),
+		Authors: mustParse("*[bot]"),
+		Labels:  []string{"duplicate", "invalid"},
+	}
+
+	prs := []struct {
+		title, author string
+		labels        []string
+		want          bool
+	}{
+		{"Fix thing", "alice", []string{"Invalid"}, true},
+		{"WIP: new thing", "bob", nil, true},
+		{"Spotless apply", "github-actions[bot]", nil, true},
+		{"Bump deps", "dependabot[bot]", []string{"duplicate"}, true},
+		{"Bump more deps", "renovate[bot]", nil, true},
+		{"Add thing", "alice", []string{"enhancement"}, false},
+	}
+	for _, pr := range prs {
+		if got := e.ExcludePR(pr.title, pr.author, pr.labels); got != pr.want {
+			t.Errorf("ExcludePR(%q, %q, %v) = %v, want %v", pr.title, pr.author, pr.labels, got, pr.want)
+		}
+	}
+
+	// Counted against the first matching rule, in the order rules are checked
+	want := []ExclusionCount{
+		{Rule: "title *Spotless*", Count: 1},
+		{Rule: "title re:^WIP", Count: 1},
+		{Rule: "author *[bot]", Count: 2},
+		{Rule: "label invalid", Count: 1},
+	}
+	if got := e.Counts(); !slices.Equal(got, want) {
+		t.Errorf("got counts %v, want %v", got, want)
+	}
+}
+
+func TestNilExclusions(t *testing.T) {
+	var e *Exclusions
+	if e.ExcludeRepo("repo") || e.ExcludePR("title", "author", []string{"label"}) {
+		t.Error("nil exclusions excluded something")
+	}
+	if counts := e.Counts(); counts != nil {
+		t.Errorf("got counts %v from nil exclusions", counts)
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/google/go-github/v67/github"
+
+	nhgithub "github.com/serenibyss/nhprtracker/github"
+	"github.com/serenibyss/nhprtracker/internal"
+)
+
+// jsonSchemaVersion is bumped whenever a field is removed or changes meaning
+// in the JSON output, so consumers can detect incompatible documents.
+const jsonSchemaVersion = 1
+
+type jsonDocument struct {
+	SchemaVersion   int              `json:"schema_version"`
+	Command         string           `json:"command"`
+	Organization    string           `json:"organization"`
+	ReleaseBranch   string           `json:"release_branch,omitempty"`
+	ReleaseBranches []string         `json:"release_branches,omitempty"`
+	StartDate       string           `json:"start_date"`
+	EndDate         string           `json:"end_date,omitempty"`
+	SinceTag        string           `json:"since_tag,omitempty"`
+	UntilTag        string           `json:"until_tag,omitempty"`
+	GeneratedAt     time.Time        `json:"generated_at"`
+	Repositories    []jsonRepository `json:"repositories"`
+
+	// Excluded holds the number of PRs each exclusion rule left out.
+	Excluded []internal.ExclusionCount `json:"excluded,omitempty"`
+}
+
+type jsonRepository struct {
+	Name         string            `json:"name"`
+	PullRequests []jsonPullRequest `json:"pull_requests"`
+}
+
+type jsonPullRequest struct {
+	Number         int         `json:"number"`
+	Title          string      `json:"title"`
+	URL            string      `json:"url"`
+	Author         string      `json:"author"`
+	MergedAt       time.Time   `json:"merged_at"`
+	MergeCommitSHA string      `json:"merge_commit_sha"`
+	Labels         []string    `json:"labels"`
+	BaseBranch     string      `json:"base_branch"`
+	MissingReason  string      `json:"missing_reason,omitempty"`
+	RevertedBy     *jsonRevert `json:"reverted_by,omitempty"`
+	Reverts        int         `json:"reverts,omitempty"`
+
+	// Branches maps each release branch to the state of the PR on it.
+	Branches map[string]nhgithub.BranchState `json:"branches,omitempty"`
+
+	// MatchedBy maps each release branch containing the PR to the strategy
+	// that found it there.
+	MatchedBy map[string]nhgithub.MatchStrategy `json:"matched_by,omitempty"`
+}
+
+type jsonRevert struct {
+	Number int    `json:"number,omitempty"`
+	SHA    string `json:"sha,omitempty"`
+}
+
+func printJSONPRList(report *Report) error {
+	doc := jsonDocument{
+		SchemaVersion: jsonSchemaVersion,
+		Command:       report.Command,
+		Organization:  report.Org,
+		StartDate:     report.Date.Format(time.DateOnly),
+		SinceTag:      report.SinceTag,
+		UntilTag:      report.UntilTag,
+		GeneratedAt:   time.Now().UTC(),
+		Repositories:  []jsonRepository{},
+		Excluded:      report.Excluded,
+	}
+	if !report.EndDate.IsZero() {
+		doc.EndDate = report.EndDate.Format(time.DateOnly)
+	}
+	if report.Matrix != nil {
+		if len(report.Matrix.Branches) == 1 {
+			doc.ReleaseBranch = report.Matrix.Branches[0]
+		}
+		doc.ReleaseBranches = report.Matrix.Branches
+	}
+
+	for _, k := range sortedRepoNames(report.PRs) {
+		repo := jsonRepository{
+			Name:         k,
+			PullRequests: []jsonPullRequest{},
+		}
+		for _, pr := range report.PRs[k] {
+			repo.PullRequests = append(repo.PullRequests, newJSONPullRequest(report, pr))
+		}
+		doc.Repositories = append(doc.Repositories, repo)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
+
+func newJSONPullRequest(report *Report, pr *github.PullRequest) jsonPullRequest {
+	labels := []string{}
+	for _, label := range pr.Labels {
+		labels = append(labels, label.GetName())
+	}
+	jsonPR := jsonPullRequest{
+		Number:         pr.GetNumber(),
+		Title:          pr.GetTitle(),
+		URL:            pr.GetHTMLURL(),
+		Author:         pr.GetUser().GetLogin(),
+		MergedAt:       pr.GetMergedAt().UTC(),
+		MergeCommitSHA: pr.GetMergeCommitSHA(),
+		Labels:         labels,
+		BaseBranch:     pr.GetBase().GetRef(),
+		MissingReason:  report.MissingReason(pr),
+	}
+	if revert := report.Reverts.RevertedBy(pr); revert != nil {
+		jsonPR.RevertedBy = &jsonRevert{
+			Number: revert.PR.GetNumber(),
+			SHA:    revert.SHA,
+		}
+	}
+	if original := report.Reverts.RevertOf(pr); original != nil {
+		jsonPR.Reverts = original.GetNumber()
+	}
+	if report.Matrix != nil {
+		jsonPR.Branches = map[string]nhgithub.BranchState{}
+		for _, branch := range report.Matrix.Branches {
+			jsonPR.Branches[branch] = report.Matrix.State(pr, branch)
+			if strategy := report.Matrix.MatchedBy(pr, branch); strategy != "" {
+				if jsonPR.MatchedBy == nil {
+					jsonPR.MatchedBy = map[string]nhgithub.MatchStrategy{}
+				}
+				jsonPR.MatchedBy[branch] = strategy
+			}
+		}
+	}
+	return jsonPR
+}
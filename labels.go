@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"go.uber.org/zap"
+
+	nhgithub "github.com/serenibyss/nhprtracker/github"
+)
+
+type jsonLabelAudit struct {
+	SchemaVersion int                      `json:"schema_version"`
+	Organization  string                   `json:"organization"`
+	GeneratedAt   time.Time                `json:"generated_at"`
+	Clusters      []*nhgithub.LabelCluster `json:"clusters"`
+}
+
+// printLabelAudit prints a table of the labels of each cluster with their
+// usage per repo, marking clusters with near-duplicate names.
+func printLabelAudit(clusters []*nhgithub.LabelCluster) {
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "CLUSTER\tLABEL\tREPO\tCOLOR\tISSUES\tPRS")
+
+	var labels, duplicated int
+	repos := map[string]bool{}
+	for _, cluster := range clusters {
+		name := cluster.Name
+		if len(cluster.Variants) > 1 {
+			name += " *"
+			duplicated++
+		}
+		for i, label := range cluster.Labels {
+			if i > 0 {
+				name = ""
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t#%s\t%d\t%d\n", name, label.Name, label.Repo, label.Color, label.Issues, label.PullRequests)
+			repos[label.Repo] = true
+		}
+		labels += len(cluster.Labels)
+	}
+	w.Flush()
+
+	for _, line := range strings.Split(strings.TrimRight(b.String(), "\n"), "\n") {
+		zap.S().Named("output").Info(line)
+	}
+	zap.S().Named("output").Info()
+	zap.S().Named("output").Infof("%d labels across %d repos in %d clusters, %d with near-duplicate names (marked *)", labels, len(repos), len(clusters), duplicated)
+}
+
+// printLabelAuditJSON prints the label clusters with their usage per repo as
+// JSON.
+func printLabelAuditJSON(org string, clusters []*nhgithub.LabelCluster) error {
+	doc := jsonLabelAudit{
+		SchemaVersion: jsonSchemaVersion,
+		Organization:  org,
+		GeneratedAt:   time.Now().UTC(),
+		Clusters:      clusters,
+	}
+	if doc.Clusters == nil {
+		doc.Clusters = []*nhgithub.LabelCluster{}
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"go.uber.org/zap"
+
+	nhgithub "github.com/serenibyss/nhprtracker/github"
+)
+
+type jsonProtectionAudit struct {
+	SchemaVersion int                    `json:"schema_version"`
+	Organization  string                 `json:"organization"`
+	GeneratedAt   time.Time              `json:"generated_at"`
+	Branches      []jsonProtectionBranch `json:"branches"`
+}
+
+type jsonProtectionBranch struct {
+	Repo      string                 `json:"repo"`
+	Branch    string                 `json:"branch"`
+	Protected bool                   `json:"protected"`
+	Compliant bool                   `json:"compliant"`
+	Drift     []nhgithub.FieldChange `json:"drift"`
+}
+
+// printProtectionAudit prints a table of the drift of each release branch
+// from its protection profile.
+func printProtectionAudit(drifts []*nhgithub.ProtectionDrift) {
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "REPO\tBRANCH\tSTATUS\tFIELD\tCURRENT\tDESIRED")
+
+	var compliant int
+	for _, drift := range drifts {
+		if drift.Compliant() {
+			fmt.Fprintf(w, "%s\t%s\tcompliant\t\t\t\n", drift.Repo, drift.Branch)
+			compliant++
+			continue
+		}
+
+		status := "drifted"
+		if !drift.Protected {
+			status = "unprotected"
+		}
+		for i, field := range drift.Fields {
+			repo, branch, fieldStatus := drift.Repo, drift.Branch, status
+			if i > 0 {
+				repo, branch, fieldStatus = "", "", ""
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", repo, branch, fieldStatus, field.Field, field.Current, field.Desired)
+		}
+	}
+	w.Flush()
+
+	for _, line := range strings.Split(strings.TrimRight(b.String(), "\n"), "\n") {
+		zap.S().Named("output").Info(line)
+	}
+	zap.S().Named("output").Info()
+	zap.S().Named("output").Infof("%d of %d branches comply with their profile", compliant, len(drifts))
+}
+
+// printProtectionAuditJSON prints the drift of each release branch from its
+// protection profile as JSON.
+func printProtectionAuditJSON(org string, drifts []*nhgithub.ProtectionDrift) error {
+	doc := jsonProtectionAudit{
+		SchemaVersion: jsonSchemaVersion,
+		Organization:  org,
+		GeneratedAt:   time.Now().UTC(),
+		Branches:      []jsonProtectionBranch{},
+	}
+	for _, drift := range drifts {
+		fields := drift.Fields
+		if fields == nil {
+			fields = []nhgithub.FieldChange{}
+		}
+		doc.Branches = append(doc.Branches, jsonProtectionBranch{
+			Repo:      drift.Repo,
+			Branch:    drift.Branch,
+			Protected: drift.Protected,
+			Compliant: drift.Compliant(),
+			Drift:     fields,
+		})
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
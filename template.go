@@ -0,0 +1,147 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/google/go-github/v67/github"
+)
+
+// unlabeledGroup is the group name used by groupByLabel for PRs without labels.
+const unlabeledGroup = "unlabeled"
+
+// labelGroup is a set of PRs sharing a label, as returned by groupByLabel.
+type labelGroup struct {
+	Label string
+	PRs   []*github.PullRequest
+}
+
+// templateFuncs are the helper functions available to user supplied templates.
+var templateFuncs = template.FuncMap{
+	"sortPRs":      sortPRs,
+	"groupByLabel": groupByLabel,
+	"labels":       prLabels,
+	"formatDate":   formatDate,
+	"join":         strings.Join,
+	"lower":        strings.ToLower,
+	"upper":        strings.ToUpper,
+	"trim":         strings.TrimSpace,
+}
+
+func newTemplateFormatter(opts *FormatterOptions) (Formatter, error) {
+	if opts.TemplateFile == "" {
+		return nil, errors.New("template formatting requires a template file, set one with the 'template' flag")
+	}
+
+	tmpl, err := template.New(filepath.Base(opts.TemplateFile)).
+		Funcs(templateFuncs).
+		Option("missingkey=error").
+		ParseFiles(opts.TemplateFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template %s: %w", opts.TemplateFile, err)
+	}
+
+	return FormatterFunc(func(report *Report) error {
+		return tmpl.Execute(os.Stdout, report)
+	}), nil
+}
+
+// sortPRs returns a copy of the passed PRs ordered by the passed key, one of
+// 'number', 'title', 'author' or 'merged'.
+func sortPRs(key string, prs []*github.PullRequest) ([]*github.PullRequest, error) {
+	var cmp func(a, b *github.PullRequest) int
+	switch key {
+	case "number":
+		cmp = func(a, b *github.PullRequest) int { return a.GetNumber() - b.GetNumber() }
+	case "title":
+		cmp = func(a, b *github.PullRequest) int { return strings.Compare(a.GetTitle(), b.GetTitle()) }
+	case "author":
+		cmp = func(a, b *github.PullRequest) int {
+			return strings.Compare(a.GetUser().GetLogin(), b.GetUser().GetLogin())
+		}
+	case "merged":
+		cmp = func(a, b *github.PullRequest) int { return a.GetMergedAt().Compare(b.GetMergedAt().Time) }
+	default:
+		return nil, fmt.Errorf("unsupported sort key %s, allowed: 'number', 'title', 'author', 'merged'", key)
+	}
+
+	sorted := slices.Clone(prs)
+	slices.SortStableFunc(sorted, cmp)
+	return sorted, nil
+}
+
+// groupByLabel groups the passed PRs by each of their labels, in alphabetical
+// order of label name. A PR with several labels appears in several groups,
+// and PRs without labels are collected in a trailing 'unlabeled' group.
+func groupByLabel(prs []*github.PullRequest) []labelGroup {
+	groups := map[string][]*github.PullRequest{}
+	var unlabeled []*github.PullRequest
+	for _, pr := range prs {
+		if len(pr.Labels) == 0 {
+			unlabeled = append(unlabeled, pr)
+			continue
+		}
+		for _, label := range pr.Labels {
+			groups[label.GetName()] = append(groups[label.GetName()], pr)
+		}
+	}
+
+	var names []string
+	for name := range groups {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	var result []labelGroup
+	for _, name := range names {
+		result = append(result, labelGroup{Label: name, PRs: groups[name]})
+	}
+	if len(unlabeled) != 0 {
+		result = append(result, labelGroup{Label: unlabeledGroup, PRs: unlabeled})
+	}
+	return result
+}
+
+// prLabels returns the label names of the passed PR.
+func prLabels(pr *github.PullRequest) []string {
+	var names []string
+	for _, label := range pr.Labels {
+		names = append(names, label.GetName())
+	}
+	return names
+}
+
+// formatDate formats a time using a Go reference layout, with the shorthands
+// 'date', 'datetime' and 'rfc3339' also accepted.
+func formatDate(layout string, value any) (string, error) {
+	var t time.Time
+	switch v := value.(type) {
+	case time.Time:
+		t = v
+	case github.Timestamp:
+		t = v.Time
+	case *github.Timestamp:
+		if v == nil {
+			return "", nil
+		}
+		t = v.Time
+	default:
+		return "", fmt.Errorf("formatDate: unsupported value type %T", value)
+	}
+
+	switch layout {
+	case "date":
+		layout = time.DateOnly
+	case "datetime":
+		layout = time.DateTime
+	case "rfc3339":
+		layout = time.RFC3339
+	}
+	return t.Format(layout), nil
+}